@@ -0,0 +1,410 @@
+// Package astmatch is a small pattern language for querying go-fast ASTs. Patterns are built
+// from node-type predicates, structural matchers for the common expression kinds, wildcards
+// and captures, and are run against every node of a tree with FindAll or FindFirst:
+//
+//	// f = f - 406
+//	shift := astmatch.Assign("=", astmatch.Capture("v", astmatch.Ident()),
+//		astmatch.Binary("-", astmatch.SameIdent("v"), astmatch.Capture("n", astmatch.Is[*ast.NumberLiteral]())))
+//	if m, ok := astmatch.FindFirst(prog, shift); ok {
+//		n, _ := astmatch.Get[*ast.NumberLiteral](m.Captures, "n")
+//		...
+//	}
+//
+// Patterns look through the wrapper nodes go-fast puts around interfaces (*ast.Expression,
+// *ast.Statement, *ast.MemberProperty, *ast.BindingTarget, ...), so Is[*ast.Identifier]()
+// matches an identifier whether it is reached directly or through its *ast.Expression.
+package astmatch
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/t14raptor/go-fast/ast"
+)
+
+// Pattern matches a single node. Match records captures in c as it goes; a failed match may
+// leave partial captures behind, which FindAll and FindFirst discard.
+type Pattern interface {
+	Match(n any, c Captures) bool
+}
+
+// PatternFunc adapts a function to Pattern.
+type PatternFunc func(n any, c Captures) bool
+
+func (f PatternFunc) Match(n any, c Captures) bool {
+	return f(n, c)
+}
+
+// Captures maps capture names to nodes, stored the way their parent holds them, e.g. call
+// arguments as *ast.Expression.
+type Captures map[string]any
+
+// Get returns the capture called name as a T, looking through wrapper nodes.
+func Get[T any](c Captures, name string) (T, bool) {
+	v, ok := Unwrap(c[name]).(T)
+	return v, ok
+}
+
+// Match is a node a pattern matched, with its captures.
+type Match struct {
+	Node     ast.VisitableNode
+	Captures Captures
+}
+
+// Unwrap returns the node a wrapper holds, or n itself when it is not a wrapper.
+func Unwrap(n any) any {
+	for {
+		switch w := n.(type) {
+		case *ast.Expression:
+			if w == nil || w.Expr == nil {
+				return nil
+			}
+			n = w.Expr
+		case *ast.Statement:
+			if w == nil || w.Stmt == nil {
+				return nil
+			}
+			n = w.Stmt
+		case *ast.MemberProperty:
+			if w == nil || w.Prop == nil {
+				return nil
+			}
+			n = w.Prop
+		case *ast.BindingTarget:
+			if w == nil || w.Target == nil {
+				return nil
+			}
+			n = w.Target
+		case *ast.Property:
+			if w == nil || w.Prop == nil {
+				return nil
+			}
+			n = w.Prop
+		case *ast.ForLoopInitializer:
+			if w == nil || w.Initializer == nil {
+				return nil
+			}
+			n = w.Initializer
+		case *ast.ConciseBody:
+			if w == nil || w.Body == nil {
+				return nil
+			}
+			n = w.Body
+		case *ast.ForInto:
+			if w == nil || w.Into == nil {
+				return nil
+			}
+			n = w.Into
+		default:
+			return n
+		}
+	}
+}
+
+// isWrapper reports whether n only exists to hold other nodes. The search functions skip
+// wrappers so every node is tried once.
+func isWrapper(n ast.VisitableNode) bool {
+	switch n.(type) {
+	case *ast.Expression, *ast.Statement, *ast.MemberProperty, *ast.BindingTarget, *ast.Property,
+		*ast.ForLoopInitializer, *ast.ConciseBody, *ast.ForInto,
+		*ast.Expressions, *ast.Statements, *ast.Properties, *ast.VariableDeclarators,
+		*ast.CaseStatements, *ast.ClassElements, *ast.TemplateElements:
+		return true
+	}
+	return false
+}
+
+// FindAll returns every node under root, root included, that p matches, in source order.
+func FindAll(root ast.VisitableNode, p Pattern) []Match {
+	return find(root, p, false, true)
+}
+
+// FindFirst returns the first node under root in source order that p matches.
+func FindFirst(root ast.VisitableNode, p Pattern) (Match, bool) {
+	matches := find(root, p, true, true)
+	if len(matches) == 0 {
+		return Match{}, false
+	}
+	return matches[0], true
+}
+
+// Children returns the nodes directly below n in source order, looking through wrappers.
+func Children(n ast.VisitableNode) []ast.VisitableNode {
+	var children []ast.VisitableNode
+	Walk(n, func(c ast.VisitableNode) bool {
+		if c == n || isWrapper(c) {
+			return true
+		}
+		children = append(children, c)
+		return false
+	})
+	return children
+}
+
+// Matches runs p against n alone.
+func Matches(n any, p Pattern) (Captures, bool) {
+	c := Captures{}
+	if !p.Match(n, c) {
+		return nil, false
+	}
+	return c, true
+}
+
+func find(root ast.VisitableNode, p Pattern, first, intoFunctions bool) []Match {
+	var matches []Match
+	w := &walker{}
+	w.fn = func(n ast.VisitableNode) bool {
+		if isWrapper(n) {
+			return true
+		}
+		c := Captures{}
+		if p.Match(n, c) {
+			matches = append(matches, Match{Node: n, Captures: c})
+			if first {
+				w.stop = true
+				return false
+			}
+		}
+		if !intoFunctions {
+			switch n.(type) {
+			case *ast.FunctionLiteral, *ast.ArrowFunctionLiteral, *ast.FunctionDeclaration:
+				return false
+			}
+		}
+		return true
+	}
+	root.VisitWith(w)
+	return matches
+}
+
+// Any matches every node, including a missing one.
+func Any() Pattern {
+	return PatternFunc(func(any, Captures) bool { return true })
+}
+
+// Is matches nodes of type T, e.g. Is[*ast.FunctionLiteral]().
+func Is[T any]() Pattern {
+	return PatternFunc(func(n any, _ Captures) bool {
+		_, ok := Unwrap(n).(T)
+		return ok
+	})
+}
+
+// Where matches nodes of type T for which fn returns true.
+func Where[T any](fn func(T) bool) Pattern {
+	return PatternFunc(func(n any, _ Captures) bool {
+		v, ok := Unwrap(n).(T)
+		return ok && fn(v)
+	})
+}
+
+// All matches when every pattern matches the same node.
+func All(ps ...Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		for _, p := range ps {
+			if !p.Match(n, c) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyOf matches when one of the patterns does, keeping only that pattern's captures.
+func AnyOf(ps ...Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		for _, p := range ps {
+			try := maps.Clone(c)
+			if p.Match(n, try) {
+				maps.Copy(c, try)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches when p does not. Captures made by p are dropped.
+func Not(p Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		return !p.Match(n, maps.Clone(c))
+	})
+}
+
+// Capture matches what p matches and records the node under name.
+func Capture(name string, p Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		if !p.Match(n, c) {
+			return false
+		}
+		c[name] = n
+		return true
+	})
+}
+
+// Contains matches a node when p matches it or any node below it, with the captures of the
+// first such match.
+func Contains(p Pattern) Pattern {
+	return contains(p, true)
+}
+
+// ContainsShallow is Contains without looking inside function bodies, including the body of
+// the node itself when it is a function.
+func ContainsShallow(p Pattern) Pattern {
+	return contains(p, false)
+}
+
+func contains(p Pattern, intoFunctions bool) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		root, ok := Unwrap(n).(ast.VisitableNode)
+		if !ok {
+			return false
+		}
+		matches := find(root, p, true, intoFunctions)
+		if len(matches) == 0 {
+			return false
+		}
+		maps.Copy(c, matches[0].Captures)
+		return true
+	})
+}
+
+// Ident matches an identifier, restricted to names when any are given.
+func Ident(names ...string) Pattern {
+	return PatternFunc(func(n any, _ Captures) bool {
+		id, ok := Unwrap(n).(*ast.Identifier)
+		return ok && (len(names) == 0 || slices.Contains(names, id.Name))
+	})
+}
+
+// SameIdent matches an identifier with the name of the identifier captured under name.
+func SameIdent(name string) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		id, ok := Unwrap(n).(*ast.Identifier)
+		if !ok {
+			return false
+		}
+		prev, ok := Get[*ast.Identifier](c, name)
+		return ok && prev.Name == id.Name
+	})
+}
+
+// Str matches a string literal, restricted to values when any are given.
+func Str(values ...string) Pattern {
+	return PatternFunc(func(n any, _ Captures) bool {
+		lit, ok := Unwrap(n).(*ast.StringLiteral)
+		return ok && (len(values) == 0 || slices.Contains(values, lit.Value))
+	})
+}
+
+// Prop matches a member property or an object key that names name: `.name`, `["name"]`,
+// `name:` or `"name":`.
+func Prop(name string) Pattern {
+	return PatternFunc(func(n any, _ Captures) bool {
+		got, ok := PropName(n)
+		return ok && got == name
+	})
+}
+
+// PropName returns the name of a dot or string-literal member property, or of an identifier
+// or string-literal object key.
+func PropName(n any) (string, bool) {
+	switch p := Unwrap(n).(type) {
+	case *ast.Identifier:
+		return p.Name, true
+	case *ast.StringLiteral:
+		return p.Value, true
+	case *ast.ComputedProperty:
+		if lit, ok := Unwrap(p.Expr).(*ast.StringLiteral); ok {
+			return lit.Value, true
+		}
+	}
+	return "", false
+}
+
+// Assign matches an assignment. An empty op matches every assignment operator.
+func Assign(op string, left, right Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		a, ok := Unwrap(n).(*ast.AssignExpression)
+		return ok && (op == "" || a.Operator.String() == op) && left.Match(a.Left, c) && right.Match(a.Right, c)
+	})
+}
+
+// Binary matches a binary or logical expression. An empty op matches every operator.
+func Binary(op string, left, right Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		b, ok := Unwrap(n).(*ast.BinaryExpression)
+		return ok && (op == "" || b.Operator.String() == op) && left.Match(b.Left, c) && right.Match(b.Right, c)
+	})
+}
+
+// Unary matches a unary expression. An empty op matches every operator.
+func Unary(op string, operand Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		u, ok := Unwrap(n).(*ast.UnaryExpression)
+		return ok && (op == "" || u.Operator.String() == op) && operand.Match(u.Operand, c)
+	})
+}
+
+// Member matches a member expression whose object and property match. The property pattern
+// sees the *ast.MemberProperty, so Prop and Is[*ast.ComputedProperty] both work.
+func Member(object, property Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		m, ok := Unwrap(n).(*ast.MemberExpression)
+		return ok && object.Match(m.Object, c) && property.Match(m.Property, c)
+	})
+}
+
+// Declarator matches a variable declarator such as `x = {}` in `var x = {}`. A declarator
+// without an initializer offers nil to init.
+func Declarator(target, init Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		d, ok := Unwrap(n).(*ast.VariableDeclarator)
+		if !ok || !target.Match(d.Target, c) {
+			return false
+		}
+		if d.Initializer == nil {
+			return init.Match(nil, c)
+		}
+		return init.Match(d.Initializer, c)
+	})
+}
+
+// Call matches a call whose callee and arguments match. The argument count must be exact
+// unless the last pattern is Rest.
+func Call(callee Pattern, args ...Pattern) Pattern {
+	return PatternFunc(func(n any, c Captures) bool {
+		call, ok := Unwrap(n).(*ast.CallExpression)
+		return ok && callee.Match(call.Callee, c) && matchList(call.ArgumentList, args, c)
+	})
+}
+
+// Rest, as the last argument pattern of Call, matches any number of remaining arguments.
+func Rest() Pattern {
+	return rest{}
+}
+
+type rest struct{}
+
+func (rest) Match(any, Captures) bool { return true }
+
+func matchList(list ast.Expressions, ps []Pattern, c Captures) bool {
+	if n := len(ps); n > 0 {
+		if _, ok := ps[n-1].(rest); ok {
+			ps = ps[:n-1]
+			if len(list) < len(ps) {
+				return false
+			}
+			list = list[:len(ps)]
+		}
+	}
+	if len(list) != len(ps) {
+		return false
+	}
+	for i, p := range ps {
+		if !p.Match(&list[i], c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package astmatch
+
+import "github.com/t14raptor/go-fast/ast"
+
+// walker forwards every node to visit. It implements ast.Visitor without embedding
+// ast.NoopVisitor, so the build breaks instead of silently skipping a subtree if go-fast grows a
+// node kind.
+type walker struct {
+	fn   func(n ast.VisitableNode) bool
+	stop bool
+}
+
+// Walk calls fn for every node under root in source order, root included, descending into a
+// node's children only when fn returns true. Wrapper nodes such as *ast.Expression and
+// *ast.Statement are reported as well as the nodes they hold.
+func Walk(root ast.VisitableNode, fn func(n ast.VisitableNode) bool) {
+	root.VisitWith(&walker{fn: fn})
+}
+
+func (w *walker) visit(n ast.VisitableNode) {
+	if w.stop {
+		return
+	}
+	if w.fn(n) {
+		n.VisitChildrenWith(w)
+	}
+}
+
+func (w *walker) VisitArrayLiteral(n *ast.ArrayLiteral)                   { w.visit(n) }
+func (w *walker) VisitArrayPattern(n *ast.ArrayPattern)                   { w.visit(n) }
+func (w *walker) VisitArrowFunctionLiteral(n *ast.ArrowFunctionLiteral)   { w.visit(n) }
+func (w *walker) VisitAssignExpression(n *ast.AssignExpression)           { w.visit(n) }
+func (w *walker) VisitAwaitExpression(n *ast.AwaitExpression)             { w.visit(n) }
+func (w *walker) VisitBadStatement(n *ast.BadStatement)                   { w.visit(n) }
+func (w *walker) VisitBinaryExpression(n *ast.BinaryExpression)           { w.visit(n) }
+func (w *walker) VisitBindingTarget(n *ast.BindingTarget)                 { w.visit(n) }
+func (w *walker) VisitBlockStatement(n *ast.BlockStatement)               { w.visit(n) }
+func (w *walker) VisitBooleanLiteral(n *ast.BooleanLiteral)               { w.visit(n) }
+func (w *walker) VisitBreakStatement(n *ast.BreakStatement)               { w.visit(n) }
+func (w *walker) VisitCallExpression(n *ast.CallExpression)               { w.visit(n) }
+func (w *walker) VisitCaseStatement(n *ast.CaseStatement)                 { w.visit(n) }
+func (w *walker) VisitCaseStatements(n *ast.CaseStatements)               { w.visit(n) }
+func (w *walker) VisitCatchStatement(n *ast.CatchStatement)               { w.visit(n) }
+func (w *walker) VisitClassDeclaration(n *ast.ClassDeclaration)           { w.visit(n) }
+func (w *walker) VisitClassElement(n *ast.ClassElement)                   { w.visit(n) }
+func (w *walker) VisitClassElements(n *ast.ClassElements)                 { w.visit(n) }
+func (w *walker) VisitClassLiteral(n *ast.ClassLiteral)                   { w.visit(n) }
+func (w *walker) VisitClassStaticBlock(n *ast.ClassStaticBlock)           { w.visit(n) }
+func (w *walker) VisitComputedProperty(n *ast.ComputedProperty)           { w.visit(n) }
+func (w *walker) VisitConciseBody(n *ast.ConciseBody)                     { w.visit(n) }
+func (w *walker) VisitConditionalExpression(n *ast.ConditionalExpression) { w.visit(n) }
+func (w *walker) VisitContinueStatement(n *ast.ContinueStatement)         { w.visit(n) }
+func (w *walker) VisitDebuggerStatement(n *ast.DebuggerStatement)         { w.visit(n) }
+func (w *walker) VisitDoWhileStatement(n *ast.DoWhileStatement)           { w.visit(n) }
+func (w *walker) VisitEmptyStatement(n *ast.EmptyStatement)               { w.visit(n) }
+func (w *walker) VisitExpression(n *ast.Expression)                       { w.visit(n) }
+func (w *walker) VisitExpressionStatement(n *ast.ExpressionStatement)     { w.visit(n) }
+func (w *walker) VisitExpressions(n *ast.Expressions)                     { w.visit(n) }
+func (w *walker) VisitFieldDefinition(n *ast.FieldDefinition)             { w.visit(n) }
+func (w *walker) VisitForInStatement(n *ast.ForInStatement)               { w.visit(n) }
+func (w *walker) VisitForInto(n *ast.ForInto)                             { w.visit(n) }
+func (w *walker) VisitForLoopInitializer(n *ast.ForLoopInitializer)       { w.visit(n) }
+func (w *walker) VisitForOfStatement(n *ast.ForOfStatement)               { w.visit(n) }
+func (w *walker) VisitForStatement(n *ast.ForStatement)                   { w.visit(n) }
+func (w *walker) VisitFunctionDeclaration(n *ast.FunctionDeclaration)     { w.visit(n) }
+func (w *walker) VisitFunctionLiteral(n *ast.FunctionLiteral)             { w.visit(n) }
+func (w *walker) VisitIdentifier(n *ast.Identifier)                       { w.visit(n) }
+func (w *walker) VisitIfStatement(n *ast.IfStatement)                     { w.visit(n) }
+func (w *walker) VisitInvalidExpression(n *ast.InvalidExpression)         { w.visit(n) }
+func (w *walker) VisitLabelledStatement(n *ast.LabelledStatement)         { w.visit(n) }
+func (w *walker) VisitMemberExpression(n *ast.MemberExpression)           { w.visit(n) }
+func (w *walker) VisitMemberProperty(n *ast.MemberProperty)               { w.visit(n) }
+func (w *walker) VisitMetaProperty(n *ast.MetaProperty)                   { w.visit(n) }
+func (w *walker) VisitMethodDefinition(n *ast.MethodDefinition)           { w.visit(n) }
+func (w *walker) VisitNewExpression(n *ast.NewExpression)                 { w.visit(n) }
+func (w *walker) VisitNullLiteral(n *ast.NullLiteral)                     { w.visit(n) }
+func (w *walker) VisitNumberLiteral(n *ast.NumberLiteral)                 { w.visit(n) }
+func (w *walker) VisitObjectLiteral(n *ast.ObjectLiteral)                 { w.visit(n) }
+func (w *walker) VisitObjectPattern(n *ast.ObjectPattern)                 { w.visit(n) }
+func (w *walker) VisitOptional(n *ast.Optional)                           { w.visit(n) }
+func (w *walker) VisitOptionalChain(n *ast.OptionalChain)                 { w.visit(n) }
+func (w *walker) VisitParameterList(n *ast.ParameterList)                 { w.visit(n) }
+func (w *walker) VisitPrivateDotExpression(n *ast.PrivateDotExpression)   { w.visit(n) }
+func (w *walker) VisitPrivateIdentifier(n *ast.PrivateIdentifier)         { w.visit(n) }
+func (w *walker) VisitProgram(n *ast.Program)                             { w.visit(n) }
+func (w *walker) VisitProperties(n *ast.Properties)                       { w.visit(n) }
+func (w *walker) VisitProperty(n *ast.Property)                           { w.visit(n) }
+func (w *walker) VisitPropertyKeyed(n *ast.PropertyKeyed)                 { w.visit(n) }
+func (w *walker) VisitPropertyShort(n *ast.PropertyShort)                 { w.visit(n) }
+func (w *walker) VisitRegExpLiteral(n *ast.RegExpLiteral)                 { w.visit(n) }
+func (w *walker) VisitReturnStatement(n *ast.ReturnStatement)             { w.visit(n) }
+func (w *walker) VisitSequenceExpression(n *ast.SequenceExpression)       { w.visit(n) }
+func (w *walker) VisitSpreadElement(n *ast.SpreadElement)                 { w.visit(n) }
+func (w *walker) VisitStatement(n *ast.Statement)                         { w.visit(n) }
+func (w *walker) VisitStatements(n *ast.Statements)                       { w.visit(n) }
+func (w *walker) VisitStringLiteral(n *ast.StringLiteral)                 { w.visit(n) }
+func (w *walker) VisitSuperExpression(n *ast.SuperExpression)             { w.visit(n) }
+func (w *walker) VisitSwitchStatement(n *ast.SwitchStatement)             { w.visit(n) }
+func (w *walker) VisitTemplateElement(n *ast.TemplateElement)             { w.visit(n) }
+func (w *walker) VisitTemplateElements(n *ast.TemplateElements)           { w.visit(n) }
+func (w *walker) VisitTemplateLiteral(n *ast.TemplateLiteral)             { w.visit(n) }
+func (w *walker) VisitThisExpression(n *ast.ThisExpression)               { w.visit(n) }
+func (w *walker) VisitThrowStatement(n *ast.ThrowStatement)               { w.visit(n) }
+func (w *walker) VisitTryStatement(n *ast.TryStatement)                   { w.visit(n) }
+func (w *walker) VisitUnaryExpression(n *ast.UnaryExpression)             { w.visit(n) }
+func (w *walker) VisitUpdateExpression(n *ast.UpdateExpression)           { w.visit(n) }
+func (w *walker) VisitVariableDeclaration(n *ast.VariableDeclaration)     { w.visit(n) }
+func (w *walker) VisitVariableDeclarator(n *ast.VariableDeclarator)       { w.visit(n) }
+func (w *walker) VisitVariableDeclarators(n *ast.VariableDeclarators)     { w.visit(n) }
+func (w *walker) VisitWhileStatement(n *ast.WhileStatement)               { w.visit(n) }
+func (w *walker) VisitWithStatement(n *ast.WithStatement)                 { w.visit(n) }
+func (w *walker) VisitYieldExpression(n *ast.YieldExpression)             { w.visit(n) }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fxnatic/jsd-solver-go/solver"
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+// analysis is the summary analyze prints unless -full is given: string tables show their size
+// instead of their entries, and functions and probe lists are left out.
+type analysis struct {
+	Signature        string            `json:"signature"`
+	KnownVariant     bool              `json:"known_variant"`
+	Variant          *visitors.Variant `json:"variant,omitempty"`
+	Sitekey          string            `json:"sitekey"`
+	OneshotPath      string            `json:"oneshot_path"`
+	LZAlphabet       string            `json:"lz_alphabet"`
+	LZAlphabetSource string            `json:"lz_alphabet_source"`
+	StringTables     []tableSummary    `json:"string_tables"`
+}
+
+type tableSummary struct {
+	Decoder  string   `json:"decoder"`
+	Function string   `json:"function"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Offset   int      `json:"offset"`
+	Target   int      `json:"target"`
+	Entries  int      `json:"entries"`
+}
+
+// runAnalyze prints what the solver reads from a script as JSON.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	full := fs.Bool("full", false, "include string-table entries, functions and probe lists")
+	variantsFile := fs.String("variants", "", "look the signature up in the variant registry `file`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	var variants *visitors.VariantRegistry
+	if *variantsFile != "" {
+		f, err := os.Open(*variantsFile)
+		if err != nil {
+			return err
+		}
+		variants, err = visitors.LoadVariantRegistry(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	texts, err := readFiles(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	a, err := solver.AnalyzeScript(fs.Arg(0), texts[0], variants)
+	if err != nil {
+		return err
+	}
+
+	var v any = a
+	if !*full {
+		summary := analysis{
+			Signature:        a.Signature,
+			KnownVariant:     a.KnownVariant,
+			Variant:          a.Variant,
+			Sitekey:          a.Sitekey,
+			OneshotPath:      a.OneshotPath,
+			LZAlphabet:       a.LZAlphabet,
+			LZAlphabetSource: a.LZAlphabetSource,
+		}
+		for _, t := range a.StringTables {
+			summary.StringTables = append(summary.StringTables, tableSummary{
+				Decoder:  t.Decoder,
+				Function: t.Function,
+				Aliases:  t.Aliases,
+				Offset:   t.Offset,
+				Target:   t.Target,
+				Entries:  len(t.Entries),
+			})
+		}
+		v = summary
+	}
+	return printJSON(v)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	return nil
+}
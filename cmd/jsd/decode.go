@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/t14raptor/go-fast/parser"
+
+	"github.com/fxnatic/jsd-solver-go/utils"
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+// runDecode decodes a captured oneshot body with the LZ alphabet of the script that sent it.
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	script := fs.String("script", "", "the JSD script that produced the body (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *script == "" || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	body := fs.Arg(0)
+	if body == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+	body = strings.TrimSpace(body)
+
+	texts, err := readFiles(*script)
+	if err != nil {
+		return err
+	}
+	prog, err := parser.ParseFile(texts[0])
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	opts := visitors.DefaultOptions()
+	opts.Source = visitors.NewSourceFile(*script, texts[0])
+	result, err := visitors.DeobfuscateCfWithOptions(prog, opts)
+	if err != nil {
+		return err
+	}
+	alphabet, err := utils.NewAlphabet(result.LZAlphabet)
+	if err != nil {
+		return fmt.Errorf("invalid LZ alphabet from %s: %w", result.LZAlphabetSource, err)
+	}
+
+	decoded, err := utils.NewLZStringFromAlphabet(alphabet).DecompressFromBase64E(body)
+	if err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(decoded), "", "  "); err != nil {
+		fmt.Println(decoded)
+		return fmt.Errorf("decoded body is not JSON: %w", err)
+	}
+	_, err = fmt.Println(out.String())
+	return err
+}
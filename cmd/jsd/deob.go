@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	fastgen "github.com/t14raptor/go-fast/generator"
+	"github.com/t14raptor/go-fast/parser"
+
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+// runDeob writes the deobfuscated script.
+func runDeob(args []string) error {
+	fs := flag.NewFlagSet("deob", flag.ContinueOnError)
+	out := fs.String("o", "", "write the script to `file` instead of standard output")
+	rename := fs.Bool("rename", true, "rename identifiers by role and position")
+	mapFile := fs.String("map", "", "also write a source map to `file`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	texts, err := readFiles(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	prog, err := parser.ParseFile(texts[0])
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	file := visitors.NewSourceFile(fs.Arg(0), texts[0])
+	opts := visitors.DefaultOptions()
+	opts.RenameIdentifiers = *rename
+	opts.Source = file
+	if _, err := visitors.DeobfuscateCfWithOptions(prog, opts); err != nil {
+		return err
+	}
+
+	var code string
+	if *mapFile != "" {
+		name := *out
+		if name == "" {
+			name = "deobf.js"
+		}
+		var sm *visitors.SourceMap
+		if code, sm, err = visitors.GenerateWithSourceMap(prog, file, name); err != nil {
+			return err
+		}
+		b, err := json.Marshal(sm)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*mapFile, b, 0o644); err != nil {
+			return err
+		}
+	} else {
+		code = fastgen.Generate(prog)
+	}
+	if err := visitors.ValidateOutput(prog, code); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = fmt.Println(code)
+		return err
+	}
+	return os.WriteFile(*out, []byte(code+"\n"), 0o644)
+}
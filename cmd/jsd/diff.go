@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/fxnatic/jsd-solver-go/solver"
+)
+
+// runDiff reports what changed between two versions of a script.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+
+	texts, err := readFiles(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	old, err := solver.AnalyzeScript(fs.Arg(0), texts[0], nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	cur, err := solver.AnalyzeScript(fs.Arg(1), texts[1], nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(1), err)
+	}
+
+	d := solver.DiffAnalyses(old, cur)
+	if *asJSON {
+		return printJSON(d)
+	}
+	fmt.Print(d)
+	return nil
+}
@@ -0,0 +1,117 @@
+// Command jsd works with Cloudflare JSD scripts saved to disk. It never touches the network.
+//
+// Usage:
+//
+//	jsd deob [-o out.js] [-map out.js.map] [-rename=false] <script.js>
+//	jsd analyze [-full] [-variants registry.json] <script.js>
+//	jsd decode -script <script.js> <body | ->
+//	jsd diff [-json] <old.js> <new.js>
+//
+// deob writes the deobfuscated script. analyze prints what the solver reads from a script as
+// JSON: the sitekey, oneshot path, LZ alphabet, signature, and the offset, rotation target and
+// aliases of each string table. decode LZ-decodes a captured oneshot body with the alphabet of
+// the script that sent it and pretty-prints the JSON. diff reports what changed between two
+// versions of a script.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"deob", "[-o out.js] [-map out.js.map] [-rename=false] <script.js>", runDeob},
+	{"analyze", "[-full] [-variants registry.json] <script.js>", runAnalyze},
+	{"decode", "-script <script.js> <body | ->", runDecode},
+	{"diff", "[-json] <old.js> <new.js>", runDiff},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		err := c.run(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: jsd %s %s\n", c.name, c.usage)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsd %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+}
+
+// errUsage makes main print the usage line of the command that returned it.
+var errUsage = errors.New("usage")
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\tjsd %s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+// readFiles reads every named file, refusing files larger than the default script size limit.
+func readFiles(names ...string) ([]string, error) {
+	limits := visitors.DefaultLimits()
+	texts := make([]string, len(names))
+	for i, name := range names {
+		b, err := readScriptFile(name, limits)
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = string(b)
+	}
+	return texts, nil
+}
+
+// readScriptFile checks the size of the named file against limits before reading it, and
+// reads no more than the limit in case the file grows meanwhile.
+func readScriptFile(name string, limits visitors.Limits) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.CheckScriptSize(info.Size()); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var r io.Reader = f
+	if limits.MaxScriptBytes > 0 {
+		r = io.LimitReader(f, limits.MaxScriptBytes+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.CheckScriptSize(int64(len(b))); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
@@ -5,6 +5,7 @@ go 1.25.1
 require (
 	github.com/bogdanfinn/fhttp v0.6.3
 	github.com/bogdanfinn/tls-client v1.11.2
+	github.com/dop251/goja v0.0.0-20260106131823-651366fbe6e3
 	github.com/iancoleman/orderedmap v0.3.0
 	github.com/t14raptor/go-fast v0.0.4
 )
@@ -14,6 +15,9 @@ require (
 	github.com/bogdanfinn/quic-go-utls v1.0.4-utls // indirect
 	github.com/bogdanfinn/utls v1.7.4-barnius // indirect
 	github.com/cloudflare/circl v1.5.0 // indirect
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
 	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/nukilabs/ftoa v1.0.0 // indirect
 	github.com/nukilabs/unicodeid v0.1.0 // indirect
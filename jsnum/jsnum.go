@@ -0,0 +1,227 @@
+// Package jsnum implements the ECMAScript number conversions the deobfuscator needs to agree
+// with a browser: ToNumber on strings, parseInt, parseFloat, ToInt32/ToUint32 and
+// Number::toString. NaN and the infinities propagate as they do in JavaScript; nothing here
+// substitutes 0 for a value JavaScript would not.
+package jsnum
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	decimalLiteral = regexp.MustCompile(`^[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?$`)
+	decimalPrefix  = regexp.MustCompile(`^[+-]?(?:Infinity|(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)`)
+)
+
+// isSpace reports whether r is WhiteSpace or a LineTerminator, the characters the string
+// conversions trim.
+func isSpace(r rune) bool {
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r', ' ', 0xa0, 0x1680, 0x2028, 0x2029, 0x202f, 0x205f, 0x3000, 0xfeff:
+		return true
+	}
+	return r >= 0x2000 && r <= 0x200a
+}
+
+// ToNumber implements StringToNumber: surrounding whitespace is ignored, the empty string is
+// 0, 0x/0o/0b prefixes select a radix, and anything that is not a complete numeric literal is
+// NaN.
+func ToNumber(s string) float64 {
+	s = strings.TrimFunc(s, isSpace)
+	switch s {
+	case "":
+		return 0
+	case "Infinity", "+Infinity":
+		return math.Inf(1)
+	case "-Infinity":
+		return math.Inf(-1)
+	}
+
+	if len(s) > 2 && s[0] == '0' {
+		radix := 0
+		switch s[1] {
+		case 'x', 'X':
+			radix = 16
+		case 'o', 'O':
+			radix = 8
+		case 'b', 'B':
+			radix = 2
+		}
+		if radix != 0 {
+			if digitPrefix(s[2:], radix) != len(s)-2 {
+				return math.NaN()
+			}
+			return parseDigits(s[2:], radix)
+		}
+	}
+
+	if !decimalLiteral.MatchString(s) {
+		return math.NaN()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return math.NaN()
+	}
+	return f
+}
+
+// ParseInt implements the global parseInt. radix is the ToInt32 of the second argument, so 0
+// stands for an absent radix.
+func ParseInt(s string, radix int32) float64 {
+	s = strings.TrimLeftFunc(s, isSpace)
+
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	stripPrefix := true
+	if radix != 0 {
+		if radix < 2 || radix > 36 {
+			return math.NaN()
+		}
+		stripPrefix = radix == 16
+	} else {
+		radix = 10
+	}
+	if stripPrefix && len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+		radix = 16
+	}
+
+	n := digitPrefix(s, int(radix))
+	if n == 0 {
+		return math.NaN()
+	}
+	f := parseDigits(s[:n], int(radix))
+	if negative {
+		return -f
+	}
+	return f
+}
+
+// ParseFloat implements the global parseFloat: the longest prefix of s, after leading
+// whitespace, that is a decimal literal or Infinity.
+func ParseFloat(s string) float64 {
+	s = strings.TrimLeftFunc(s, isSpace)
+	prefix := decimalPrefix.FindString(s)
+	if prefix == "" {
+		return math.NaN()
+	}
+	switch strings.TrimLeft(prefix, "+-") {
+	case "Infinity":
+		if prefix[0] == '-' {
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	}
+	f, err := strconv.ParseFloat(prefix, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return math.NaN()
+	}
+	return f
+}
+
+// ToInt32 implements ToInt32: NaN and the infinities become 0, everything else is truncated
+// and wrapped modulo 2^32.
+func ToInt32(f float64) int32 {
+	return int32(ToUint32(f))
+}
+
+// ToUint32 implements ToUint32.
+func ToUint32(f float64) uint32 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	m := math.Mod(math.Trunc(f), 1<<32)
+	if m < 0 {
+		m += 1 << 32
+	}
+	return uint32(m)
+}
+
+// ToString implements Number::toString with radix 10: the shortest round-trip digits, in
+// plain notation for exponents in [-7, 21) and exponential notation otherwise.
+func ToString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// 'e' formatting with -1 precision yields the shortest digits as d.ddde±xx.
+	mant, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mant, ".", "", 1)
+	e, _ := strconv.Atoi(exp)
+	k := len(digits)
+	n := e + 1
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+
+	expSign := "+"
+	if n-1 < 0 {
+		expSign = "-"
+	}
+	expStr := expSign + strconv.Itoa(max(n-1, 1-n))
+	if k == 1 {
+		return sign + digits + "e" + expStr
+	}
+	return sign + digits[:1] + "." + digits[1:] + "e" + expStr
+}
+
+// digitPrefix returns the length of the longest prefix of s made of digits valid in radix.
+func digitPrefix(s string, radix int) int {
+	for i := 0; i < len(s); i++ {
+		if d, ok := digitValue(s[i]); !ok || d >= radix {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func digitValue(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10, true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+// parseDigits converts a run of valid digits to the nearest double, so long runs round
+// correctly instead of overflowing.
+func parseDigits(digits string, radix int) float64 {
+	n, ok := new(big.Int).SetString(digits, radix)
+	if !ok {
+		return math.NaN()
+	}
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f
+}
@@ -0,0 +1,69 @@
+package solver
+
+import (
+	"fmt"
+
+	fastgen "github.com/t14raptor/go-fast/generator"
+	"github.com/t14raptor/go-fast/parser"
+
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+// ScriptAnalysis is what a JSD script tells about itself once deobfuscated, without solving it.
+type ScriptAnalysis struct {
+	Sitekey          string `json:"sitekey"`
+	OneshotPath      string `json:"oneshot_path"`
+	LZAlphabet       string `json:"lz_alphabet"`
+	LZAlphabetSource string `json:"lz_alphabet_source"`
+
+	Signature    string            `json:"signature"`
+	KnownVariant bool              `json:"known_variant"`
+	Variant      *visitors.Variant `json:"variant,omitempty"`
+
+	StringTables []visitors.StringTable `json:"string_tables"`
+	// ProbeLists are the string lists of the script, such as the properties it fingerprints.
+	ProbeLists []visitors.StringList    `json:"probe_lists"`
+	Functions  []visitors.FunctionShape `json:"functions"`
+
+	// Code is the deobfuscated script, with identifiers renamed by role and position.
+	Code string `json:"-"`
+}
+
+// AnalyzeScript deobfuscates src with identifier renaming and reads the solver parameters and
+// the structure of the script from it. name is the file name positions refer to. variants may
+// be nil.
+func AnalyzeScript(name, src string, variants *visitors.VariantRegistry) (*ScriptAnalysis, error) {
+	opts := visitors.DefaultOptions()
+	if err := opts.Limits.CheckScriptSize(int64(len(src))); err != nil {
+		return nil, err
+	}
+	prog, err := parser.ParseFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+
+	file := visitors.NewSourceFile(name, src)
+	opts.RenameIdentifiers = true
+	opts.Source = file
+	opts.Variants = variants
+	result, err := visitors.DeobfuscateCfWithOptions(prog, opts)
+	if err != nil {
+		return nil, fmt.Errorf("deobfuscation error: %w", err)
+	}
+
+	a := &ScriptAnalysis{
+		LZAlphabet:       result.LZAlphabet,
+		LZAlphabetSource: result.LZAlphabetSource.String(),
+		Signature:        result.Signature,
+		KnownVariant:     result.KnownVariant,
+		StringTables:     result.Tables,
+		ProbeLists:       visitors.StringLists(prog, file),
+		Functions:        visitors.FunctionShapes(prog, file),
+		Code:             fastgen.Generate(prog),
+	}
+	if result.KnownVariant {
+		a.Variant = &result.Variant
+	}
+	a.Sitekey, a.OneshotPath = extractScriptParams(a.Code)
+	return a, nil
+}
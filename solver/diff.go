@@ -0,0 +1,290 @@
+package solver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fxnatic/jsd-solver-go/visitors"
+)
+
+// ScriptDiff is what changed between two versions of a JSD script. Both are compared after
+// deobfuscation with identifiers renamed, functions are lined up by structure and string lists
+// by their overlap, so fresh mangling and a reshuffled string table do not count as changes.
+type ScriptDiff struct {
+	Signature   *ValueChange `json:"signature,omitempty"`
+	Sitekey     *ValueChange `json:"sitekey,omitempty"`
+	OneshotPath *ValueChange `json:"oneshot_path,omitempty"`
+	LZAlphabet  *ValueChange `json:"lz_alphabet,omitempty"`
+
+	StringTables []TableChange `json:"string_tables,omitempty"`
+
+	AddedFunctions   []visitors.FunctionShape `json:"added_functions,omitempty"`
+	RemovedFunctions []visitors.FunctionShape `json:"removed_functions,omitempty"`
+	// ChangedFunctions have the same structure in both scripts but different literals or
+	// globals and properties.
+	ChangedFunctions []FunctionChange `json:"changed_functions,omitempty"`
+
+	ProbeLists []ListChange `json:"probe_lists,omitempty"`
+}
+
+// ValueChange is a value that differs between the two scripts.
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// TableChange lists the entries the string table at Index gained and lost. A table only one
+// script has shows with all its entries added or removed.
+type TableChange struct {
+	Index   int      `json:"index"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// FunctionChange pairs a function with its counterpart in the new script.
+type FunctionChange struct {
+	Old visitors.FunctionShape `json:"old"`
+	New visitors.FunctionShape `json:"new"`
+}
+
+// ListChange is a string list that was added, removed or edited. Old is nil for an added list
+// and New for a removed one.
+type ListChange struct {
+	Old       *visitors.Position `json:"old,omitempty"`
+	New       *visitors.Position `json:"new,omitempty"`
+	Added     []string           `json:"added,omitempty"`
+	Removed   []string           `json:"removed,omitempty"`
+	Reordered bool               `json:"reordered,omitempty"`
+}
+
+// DiffScripts analyzes two versions of a script and compares them.
+func DiffScripts(oldSrc, newSrc string) (*ScriptDiff, error) {
+	a, err := AnalyzeScript("old.js", oldSrc, nil)
+	if err != nil {
+		return nil, fmt.Errorf("old script: %w", err)
+	}
+	b, err := AnalyzeScript("new.js", newSrc, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new script: %w", err)
+	}
+	return DiffAnalyses(a, b), nil
+}
+
+// DiffAnalyses compares the analyses of two versions of a script.
+func DiffAnalyses(a, b *ScriptAnalysis) *ScriptDiff {
+	d := &ScriptDiff{
+		Signature:   valueChange(a.Signature, b.Signature),
+		Sitekey:     valueChange(a.Sitekey, b.Sitekey),
+		OneshotPath: valueChange(a.OneshotPath, b.OneshotPath),
+		LZAlphabet:  valueChange(a.LZAlphabet, b.LZAlphabet),
+	}
+
+	for i := range max(len(a.StringTables), len(b.StringTables)) {
+		var old, cur []string
+		if i < len(a.StringTables) {
+			old = a.StringTables[i].Entries
+		}
+		if i < len(b.StringTables) {
+			cur = b.StringTables[i].Entries
+		}
+		if added, removed := diffStrings(old, cur); len(added) > 0 || len(removed) > 0 {
+			d.StringTables = append(d.StringTables, TableChange{Index: i, Added: added, Removed: removed})
+		}
+	}
+
+	d.diffFunctions(a.Functions, b.Functions)
+	d.diffLists(a.ProbeLists, b.ProbeLists)
+	return d
+}
+
+func valueChange(old, cur string) *ValueChange {
+	if old == cur {
+		return nil
+	}
+	return &ValueChange{Old: old, New: cur}
+}
+
+// diffStrings returns the strings cur has more often than old, and the other way round, in the
+// order they appear.
+func diffStrings(old, cur []string) (added, removed []string) {
+	count := make(map[string]int)
+	for _, s := range old {
+		count[s]++
+	}
+	for _, s := range cur {
+		if count[s] > 0 {
+			count[s]--
+		} else {
+			added = append(added, s)
+		}
+	}
+	for _, s := range slices.Backward(old) {
+		if count[s] > 0 {
+			count[s]--
+			removed = append(removed, s)
+		}
+	}
+	slices.Reverse(removed)
+	return added, removed
+}
+
+// diffFunctions pairs identical functions first, then functions of the same structure, in source
+// order. What is left over was added or removed.
+func (d *ScriptDiff) diffFunctions(old, cur []visitors.FunctionShape) {
+	oldDone := make([]bool, len(old))
+	curDone := make([]bool, len(cur))
+	pair := func(key func(visitors.FunctionShape) string, matched func(i, j int)) {
+		queue := make(map[string][]int)
+		for i, f := range old {
+			if !oldDone[i] {
+				queue[key(f)] = append(queue[key(f)], i)
+			}
+		}
+		for j, f := range cur {
+			if curDone[j] || len(queue[key(f)]) == 0 {
+				continue
+			}
+			i := queue[key(f)][0]
+			queue[key(f)] = queue[key(f)][1:]
+			oldDone[i], curDone[j] = true, true
+			matched(i, j)
+		}
+	}
+
+	pair(func(f visitors.FunctionShape) string { return f.Content }, func(i, j int) {})
+	pair(func(f visitors.FunctionShape) string { return f.Shape }, func(i, j int) {
+		d.ChangedFunctions = append(d.ChangedFunctions, FunctionChange{Old: old[i], New: cur[j]})
+	})
+	for i, f := range old {
+		if !oldDone[i] {
+			d.RemovedFunctions = append(d.RemovedFunctions, f)
+		}
+	}
+	for j, f := range cur {
+		if !curDone[j] {
+			d.AddedFunctions = append(d.AddedFunctions, f)
+		}
+	}
+}
+
+// diffLists pairs every old list with the unpaired new list sharing the most strings with it.
+func (d *ScriptDiff) diffLists(old, cur []visitors.StringList) {
+	paired := make([]bool, len(cur))
+	for i := range old {
+		best, bestShared := -1, 0
+		for j := range cur {
+			if paired[j] {
+				continue
+			}
+			added, _ := diffStrings(old[i].Values, cur[j].Values)
+			if shared := len(cur[j].Values) - len(added); shared > bestShared {
+				best, bestShared = j, shared
+			}
+		}
+		if best < 0 {
+			d.ProbeLists = append(d.ProbeLists, ListChange{Old: &old[i].Position, Removed: old[i].Values})
+			continue
+		}
+		paired[best] = true
+
+		added, removed := diffStrings(old[i].Values, cur[best].Values)
+		reordered := len(added) == 0 && len(removed) == 0 && !slices.Equal(old[i].Values, cur[best].Values)
+		if len(added) > 0 || len(removed) > 0 || reordered {
+			d.ProbeLists = append(d.ProbeLists, ListChange{
+				Old:       &old[i].Position,
+				New:       &cur[best].Position,
+				Added:     added,
+				Removed:   removed,
+				Reordered: reordered,
+			})
+		}
+	}
+	for j := range cur {
+		if !paired[j] {
+			d.ProbeLists = append(d.ProbeLists, ListChange{New: &cur[j].Position, Added: cur[j].Values})
+		}
+	}
+}
+
+// Empty reports whether the two scripts did not differ in anything the diff covers.
+func (d *ScriptDiff) Empty() bool {
+	return d.Signature == nil && d.Sitekey == nil && d.OneshotPath == nil && d.LZAlphabet == nil &&
+		len(d.StringTables) == 0 && len(d.AddedFunctions) == 0 && len(d.RemovedFunctions) == 0 &&
+		len(d.ChangedFunctions) == 0 && len(d.ProbeLists) == 0
+}
+
+// String formats the diff as a text report, one section per kind of change.
+func (d *ScriptDiff) String() string {
+	if d.Empty() {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+	for _, v := range []struct {
+		name   string
+		change *ValueChange
+	}{
+		{"signature", d.Signature},
+		{"sitekey", d.Sitekey},
+		{"oneshot path", d.OneshotPath},
+		{"lz alphabet", d.LZAlphabet},
+	} {
+		if v.change != nil {
+			fmt.Fprintf(&b, "%s: %q -> %q\n", v.name, v.change.Old, v.change.New)
+		}
+	}
+
+	for _, t := range d.StringTables {
+		fmt.Fprintf(&b, "string table %d: %d added, %d removed\n", t.Index+1, len(t.Added), len(t.Removed))
+		writeStrings(&b, "  ", t.Added, t.Removed)
+	}
+
+	if len(d.AddedFunctions)+len(d.RemovedFunctions)+len(d.ChangedFunctions) > 0 {
+		fmt.Fprintf(&b, "functions: %d added, %d removed, %d changed\n", len(d.AddedFunctions), len(d.RemovedFunctions), len(d.ChangedFunctions))
+		for _, f := range d.AddedFunctions {
+			fmt.Fprintf(&b, "  + %s at %s: %s\n", functionName(f), f.Position, f.Preview)
+		}
+		for _, f := range d.RemovedFunctions {
+			fmt.Fprintf(&b, "  - %s at %s: %s\n", functionName(f), f.Position, f.Preview)
+		}
+		for _, c := range d.ChangedFunctions {
+			fmt.Fprintf(&b, "  ~ %s at %s -> %s: %s\n", functionName(c.New), c.Old.Position, c.New.Position, c.New.Preview)
+		}
+	}
+
+	if len(d.ProbeLists) > 0 {
+		b.WriteString("probe lists:\n")
+		for _, l := range d.ProbeLists {
+			switch {
+			case l.Old == nil:
+				fmt.Fprintf(&b, "  + list at %s: %d entries\n", l.New, len(l.Added))
+			case l.New == nil:
+				fmt.Fprintf(&b, "  - list at %s: %d entries\n", l.Old, len(l.Removed))
+			case l.Reordered:
+				fmt.Fprintf(&b, "  ~ list at %s -> %s: reordered\n", l.Old, l.New)
+				continue
+			default:
+				fmt.Fprintf(&b, "  ~ list at %s -> %s: %d added, %d removed\n", l.Old, l.New, len(l.Added), len(l.Removed))
+			}
+			writeStrings(&b, "    ", l.Added, l.Removed)
+		}
+	}
+	return b.String()
+}
+
+func writeStrings(b *strings.Builder, indent string, added, removed []string) {
+	for _, s := range added {
+		fmt.Fprintf(b, "%s+ %q\n", indent, s)
+	}
+	for _, s := range removed {
+		fmt.Fprintf(b, "%s- %q\n", indent, s)
+	}
+}
+
+func functionName(f visitors.FunctionShape) string {
+	if f.Name == "" {
+		return "anonymous function"
+	}
+	return f.Name
+}
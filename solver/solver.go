@@ -25,7 +25,12 @@ type OneshotSolver struct {
 	targetURL  string
 	scriptURL  string
 	debug      bool
-	lzAlphabet string
+	lzAlphabet *utils.Alphabet
+
+	variants *visitors.VariantRegistry
+	script   *visitors.DeobfuscateResult
+	limits   visitors.Limits
+	validate bool
 }
 
 type ChallengeParams struct {
@@ -66,6 +71,7 @@ func NewSolver(targetURL string, debug bool) (*OneshotSolver, error) {
 		client:    client,
 		targetURL: strings.TrimSuffix(targetURL, "/"),
 		debug:     debug,
+		limits:    visitors.DefaultLimits(),
 	}, nil
 }
 
@@ -74,6 +80,7 @@ func NewSolverWithClient(client tls_client.HttpClient, targetURL string, debug b
 		client:    client,
 		targetURL: strings.TrimSuffix(targetURL, "/"),
 		debug:     debug,
+		limits:    visitors.DefaultLimits(),
 	}, nil
 }
 
@@ -135,6 +142,30 @@ type SolveResult struct {
 	Body        string
 	Cookies     []*http.Cookie
 	CfClearance string
+
+	// ScriptSignature is the structural signature of the JSD script that was solved, and
+	// KnownVariant reports whether the solver's variant registry holds it.
+	ScriptSignature string
+	KnownVariant    bool
+}
+
+// SetVariantRegistry sets the script variants the solver reports as known.
+func (s *OneshotSolver) SetVariantRegistry(r *visitors.VariantRegistry) {
+	s.variants = r
+}
+
+// SetLimits sets the bounds on the size of the JSD script and the work of deobfuscating it.
+// Solvers start with visitors.DefaultLimits. A script over a limit fails the solve with a
+// *visitors.LimitError.
+func (s *OneshotSolver) SetLimits(l visitors.Limits) {
+	s.limits = l
+}
+
+// SetValidateOutput makes the solver check the deobfuscated script with
+// visitors.ValidateOutput before reading values from it. Validation is off by default; a
+// script that fails it fails the solve with a *visitors.ValidationError.
+func (s *OneshotSolver) SetValidateOutput(validate bool) {
+	s.validate = validate
 }
 
 func (s *OneshotSolver) fetchChallengeParams() (*ChallengeParams, []*http.Cookie, error) {
@@ -234,46 +265,34 @@ func (s *OneshotSolver) parseScript(params *ChallengeParams) error {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readScript(resp, s.limits)
 	if err != nil {
-		return fmt.Errorf("failed to read script body: %w", err)
+		return err
 	}
 
 	// os.WriteFile("script.js", []byte(body), 0644)
 	script := string(body)
 
-	deobf, result, err := deobfuscateScript(script)
+	opts := visitors.DefaultOptions()
+	opts.Variants = s.variants
+	opts.Limits = s.limits
+	deobf, result, err := deobfuscateScript(script, opts, s.validate)
 	if err != nil {
 		return fmt.Errorf("deobfuscation failed: %w", err)
 	}
 
+	alphabet, err := utils.NewAlphabet(result.LZAlphabet)
+	if err != nil {
+		return fmt.Errorf("invalid LZ alphabet from %s: %w", result.LZAlphabetSource, err)
+	}
+
 	script = deobf
-	s.lzAlphabet = result.LZAlphabet
+	s.lzAlphabet = alphabet
+	s.script = result
 
 	// os.WriteFile("deobf.js", []byte(deobf), 0644)
 
-	sitekeyRe := regexp.MustCompile(`(?:window\.)?\s*_cf_chl_opt\s*=\s*\{\s*\w+:\s*['"]([^'"]+)['"]`)
-	if m := sitekeyRe.FindStringSubmatch(script); len(m) > 1 {
-		params.Sitekey = m[1]
-	}
-
-	pathRe := regexp.MustCompile(`/jsd/oneshot/([^'",\)]+)`)
-	if m := pathRe.FindStringSubmatch(script); len(m) > 1 {
-		params.Path = m[1]
-	}
-
-	if params.Path == "" {
-		tableRe := regexp.MustCompile(`['"]([^'"]{500,})['"]\.split\(['"],['"]`)
-		if m := tableRe.FindStringSubmatch(script); len(m) > 1 {
-			table := strings.Split(m[1], ",")
-			for _, s := range table {
-				if strings.HasPrefix(s, "/jsd/oneshot/") {
-					params.Path = strings.TrimPrefix(s, "/jsd/oneshot/")
-					break
-				}
-			}
-		}
-	}
+	params.Sitekey, params.Path = extractScriptParams(script)
 
 	if params.Sitekey == "" {
 		return fmt.Errorf("could not extract sitekey from script")
@@ -300,18 +319,22 @@ func (s *OneshotSolver) sendOneshot(params *ChallengeParams, cookies []*http.Coo
 	payload.Set("api", false)
 	payload.Set("payload", fingerprint)
 
-	jsonData, err := payload.MarshalJSON()
+	jsonData, err := utils.JSONStringify(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	lz := utils.NewLZString(s.lzAlphabet)
-	compressed := lz.CompressToBase64(string(jsonData))
+	var compressed strings.Builder
+	enc := utils.NewEncoder(&compressed, s.lzAlphabet)
+	enc.Write(jsonData)
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
 
 	endpoint := fmt.Sprintf("%s/cdn-cgi/challenge-platform/h/%s/jsd/oneshot/%s%s",
 		originFromURL(s.targetURL), params.Sitekey, params.Path, params.R)
 
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(compressed))
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(compressed.String()))
 	if err != nil {
 		return nil, err
 	}
@@ -367,6 +390,10 @@ func (s *OneshotSolver) sendOneshot(params *ChallengeParams, cookies []*http.Coo
 		Cookies:    resp.Cookies(),
 		Success:    resp.StatusCode >= 200 && resp.StatusCode < 300,
 	}
+	if s.script != nil {
+		result.ScriptSignature = s.script.Signature
+		result.KnownVariant = s.script.KnownVariant
+	}
 
 	for _, c := range resp.Cookies() {
 		if c.Name == "cf_clearance" {
@@ -433,17 +460,81 @@ func originFromURL(raw string) string {
 	return u.String()
 }
 
-func deobfuscateScript(src string) (string, *visitors.DeobfuscateResult, error) {
+// readScript reads the script response, stopping as soon as it is larger than
+// limits.MaxScriptBytes.
+func readScript(resp *http.Response, limits visitors.Limits) ([]byte, error) {
+	if resp.ContentLength > 0 {
+		if err := limits.CheckScriptSize(resp.ContentLength); err != nil {
+			return nil, err
+		}
+	}
+	var r io.Reader = resp.Body
+	if limits.MaxScriptBytes > 0 {
+		r = io.LimitReader(resp.Body, limits.MaxScriptBytes+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script body: %w", err)
+	}
+	if err := limits.CheckScriptSize(int64(len(body))); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// deobfuscateScript deobfuscates src with opts and prints the result. With validate set, the
+// printed code is also checked with visitors.ValidateOutput.
+func deobfuscateScript(src string, opts visitors.Options, validate bool) (string, *visitors.DeobfuscateResult, error) {
+	if err := opts.Limits.CheckScriptSize(int64(len(src))); err != nil {
+		return "", nil, err
+	}
 	prog, err := parser.ParseFile(src)
 	if err != nil {
 		return "", nil, fmt.Errorf("parse error: %w", err)
 	}
 
-	result, err := visitors.DeobfuscateCf(prog)
+	opts.Source = visitors.NewSourceFile("main.js", src)
+	result, err := visitors.DeobfuscateCfWithOptions(prog, opts)
 	if err != nil {
 		return "", nil, fmt.Errorf("deobfuscation error: %w", err)
 	}
 
 	code := fastgen.Generate(prog)
+	if validate {
+		if err := visitors.ValidateOutput(prog, code); err != nil {
+			return "", nil, err
+		}
+	}
 	return code, result, nil
 }
+
+var (
+	sitekeyRe     = regexp.MustCompile(`(?:window\.)?\s*_cf_chl_opt\s*=\s*\{\s*\w+:\s*['"]([^'"]+)['"]`)
+	oneshotPathRe = regexp.MustCompile(`/jsd/oneshot/([^'",\)]+)`)
+	tableRe       = regexp.MustCompile(`['"]([^'"]{500,})['"]\.split\(['"],['"]`)
+)
+
+// extractScriptParams reads the sitekey and oneshot path from a deobfuscated script. Either is
+// empty when the script does not have it.
+func extractScriptParams(code string) (sitekey, path string) {
+	if m := sitekeyRe.FindStringSubmatch(code); len(m) > 1 {
+		sitekey = m[1]
+	}
+
+	if m := oneshotPathRe.FindStringSubmatch(code); len(m) > 1 {
+		path = m[1]
+	}
+
+	if path == "" {
+		if m := tableRe.FindStringSubmatch(code); len(m) > 1 {
+			table := strings.Split(m[1], ",")
+			for _, s := range table {
+				if strings.HasPrefix(s, "/jsd/oneshot/") {
+					path = strings.TrimPrefix(s, "/jsd/oneshot/")
+					break
+				}
+			}
+		}
+	}
+	return sitekey, path
+}
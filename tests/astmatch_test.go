@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+	"github.com/t14raptor/go-fast/ast"
+	"github.com/t14raptor/go-fast/parser"
+)
+
+func parseProgram(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	prog, err := parser.ParseFile(src)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", src, err)
+	}
+	return prog
+}
+
+func TestAstmatchCaptures(t *testing.T) {
+	prog := parseProgram(t, `var b=function(f,g){f=f-406;g=h-7;return f}`)
+	shift := astmatch.Assign("=",
+		astmatch.Capture("var", astmatch.Ident()),
+		astmatch.Binary("-", astmatch.SameIdent("var"), astmatch.Capture("n", astmatch.Is[*ast.NumberLiteral]())),
+	)
+
+	matches := astmatch.FindAll(prog, shift)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	id, _ := astmatch.Get[*ast.Identifier](matches[0].Captures, "var")
+	n, _ := astmatch.Get[*ast.NumberLiteral](matches[0].Captures, "n")
+	if id.Name != "f" || n.Value != 406 {
+		t.Errorf("captured %s and %v, want f and 406", id.Name, n.Value)
+	}
+
+	decl := astmatch.Declarator(astmatch.Ident("b"), astmatch.All(astmatch.Is[*ast.FunctionLiteral](), astmatch.Contains(shift)))
+	if _, ok := astmatch.FindFirst(prog, decl); !ok {
+		t.Error("expected Contains to find the shift inside the function")
+	}
+}
+
+func TestAstmatchFindAll(t *testing.T) {
+	prog := parseProgram(t, `a(1);x=()=>b(2,3);class C{m(){return c(4)}}for(const k of d(5));`)
+	var names []string
+	for _, m := range astmatch.FindAll(prog, astmatch.Call(astmatch.Capture("fn", astmatch.Ident()), astmatch.Rest())) {
+		id, _ := astmatch.Get[*ast.Identifier](m.Captures, "fn")
+		names = append(names, id.Name)
+	}
+	if got := len(names); got != 4 || names[0] != "a" || names[1] != "b" || names[2] != "c" || names[3] != "d" {
+		t.Errorf("got calls %v, want [a b c d] in source order", names)
+	}
+
+	twoArgs := astmatch.Call(astmatch.Any(), astmatch.Any(), astmatch.Any())
+	if got := len(astmatch.FindAll(prog, twoArgs)); got != 1 {
+		t.Errorf("got %d two-argument calls, want 1", got)
+	}
+	oneOrMore := astmatch.Call(astmatch.Any(), astmatch.Any(), astmatch.Rest())
+	if got := len(astmatch.FindAll(prog, oneOrMore)); got != 4 {
+		t.Errorf("got %d calls with arguments, want 4", got)
+	}
+}
+
+func TestAstmatchProp(t *testing.T) {
+	prog := parseProgram(t, `s.split(','),s['split'](','),s[k](','),o={split:1,'split':2}`)
+	if got := len(astmatch.FindAll(prog, astmatch.Member(astmatch.Any(), astmatch.Prop("split")))); got != 2 {
+		t.Errorf("got %d split members, want 2", got)
+	}
+	keyed := astmatch.Where(func(p *ast.PropertyKeyed) bool {
+		_, ok := astmatch.Matches(p.Key, astmatch.Prop("split"))
+		return ok
+	})
+	if got := len(astmatch.FindAll(prog, keyed)); got != 2 {
+		t.Errorf("got %d split keys, want 2", got)
+	}
+}
+
+func TestAstmatchContainsShallow(t *testing.T) {
+	prog := parseProgram(t, `x=function(){return parseInt(y)};z=-parseInt(y)/2`)
+	checksum := astmatch.Assign("=", astmatch.Capture("lhs", astmatch.Ident()), astmatch.ContainsShallow(astmatch.Call(astmatch.Ident("parseInt"), astmatch.Rest())))
+	matches := astmatch.FindAll(prog, checksum)
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	if id, _ := astmatch.Get[*ast.Identifier](matches[0].Captures, "lhs"); id.Name != "z" {
+		t.Errorf("matched %s, want z", id.Name)
+	}
+
+	deep := astmatch.Assign("=", astmatch.Any(), astmatch.Contains(astmatch.Call(astmatch.Ident("parseInt"), astmatch.Rest())))
+	if got := len(astmatch.FindAll(prog, deep)); got != 2 {
+		t.Errorf("got %d matches with Contains, want 2", got)
+	}
+}
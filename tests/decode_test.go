@@ -16,6 +16,8 @@ import (
 // To use:
 // 1. Place your script in tests/script.js
 // 2. Set the encoded payload in the test
+//
+// `go run ./cmd/jsd decode -script script.js <payload>` does the same without editing the test.
 func TestDecodePayload(t *testing.T) {
 	// Read script from file
 	scriptBytes, err := os.ReadFile("script.js")
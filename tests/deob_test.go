@@ -0,0 +1,771 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxnatic/jsd-solver-go/visitors"
+	"github.com/t14raptor/go-fast/ast"
+	fastgen "github.com/t14raptor/go-fast/generator"
+	"github.com/t14raptor/go-fast/parser"
+	"github.com/t14raptor/go-fast/resolver"
+)
+
+// fixtureScript returns the synthetic JSD script in testdata with extra appended to it.
+func fixtureScript(t *testing.T, extra string) string {
+	t.Helper()
+	src, err := os.ReadFile("testdata/main.js")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return string(src) + extra
+}
+
+// parseFixture parses src, failing the test if it is not valid JavaScript.
+func parseFixture(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	prog, err := parser.ParseFile(src)
+	if err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+	return prog
+}
+
+// deobfuscateFixture parses src and deobfuscates it with opts. It returns the generated code
+// along with the result and error of the deobfuscation.
+func deobfuscateFixture(t *testing.T, src string, opts visitors.Options) (string, *visitors.DeobfuscateResult, error) {
+	t.Helper()
+	prog := parseFixture(t, src)
+	result, err := visitors.DeobfuscateCfWithOptions(prog, opts)
+	return fastgen.Generate(prog), result, err
+}
+
+func TestProxyFunctionInlining(t *testing.T) {
+	code, _, err := deobfuscateFixture(t, fixtureScript(t, `
+var pw = {'f': function(a, b) { return a - b }};
+pw.f = function(a, b) { return a * b };
+pw.f(7, 8);
+var px = {'g': function(a, b) { return b + a }};
+px.g(sideA(), sideB());
+function zz(gn) { return gn(1, 2, 3) }
+var pq = function(a, b) { return a + b };
+try { pq(4, 5) } catch (pq) { pq(6, 7) }
+`), visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`console.log(i.responseText)`,
+		`i.status == 200`,
+		`2 * 3 - 1 < 1 + 9`,
+		`pw.f(7, 8)`,
+		`px.g(sideA(), sideB())`,
+		// A parameter or catch binding that shadows a wrapper is not the wrapper.
+		`return gn(1, 2, 3)`,
+		`pq(6, 7)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected output to contain %q", want)
+		}
+	}
+
+	for _, unwanted := range []string{"gm.UfLqv(", "gm.kQeYa(", "gm.zVwPn(", "gn(2"} {
+		if strings.Contains(code, unwanted) {
+			t.Errorf("expected %q to be inlined", unwanted)
+		}
+	}
+}
+
+func TestRenameIdentifiersDeterministic(t *testing.T) {
+	extra := `
+var ks = 'Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN';
+function outer(x) { var y = x + 1; return function inner(z) { return y * z }; }
+`
+	render := func() string {
+		code, _, err := deobfuscateFixture(t, fixtureScript(t, extra), visitors.Options{RenameIdentifiers: true})
+		if err != nil {
+			t.Fatalf("Deobfuscation failed: %v", err)
+		}
+		return code
+	}
+
+	first, second := render(), render()
+	if first != second {
+		t.Fatal("renamed output differs between runs")
+	}
+
+	for _, want := range []string{
+		"function decoder(",
+		"function stringTable(",
+		"decoderAlias0 = decoder",
+		"var lzAlphabet = ",
+		"var fn_16_var0 = fn_16_param0 + 1",
+		"return fn_16_var0 * fn_17_param0",
+		"window._cf_chl_opt",
+		`["responseText"]`,
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("expected renamed output to contain %q", want)
+		}
+	}
+}
+
+func TestNormalizationPasses(t *testing.T) {
+	extra := `
+function nz(q) { if (q = q + 1, q > 2) return void 0; return q["length"], !0; }
+`
+	code, _, err := deobfuscateFixture(t, fixtureScript(t, extra), visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"\n    fd = b;\n",
+		"i.open(\"POST\"",
+		"api: false",
+		"f = 1285613;\n",
+		"if (f === d) break;",
+		"e = a();\n    b = function(f, g, h) {",
+		"return b(c, d);",
+		"q = q + 1;\n    if (q > 2) return undefined;",
+		"q.length;\n    return true;",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected normalized output to contain %q", want)
+		}
+	}
+	if strings.Contains(code, "~(function") {
+		t.Error("expected IIFE operator to be dropped")
+	}
+
+	raw, _, err := deobfuscateFixture(t, fixtureScript(t, extra), visitors.Options{})
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+	for _, want := range []string{`i["open"]("POST"`, "api: !1", "~(function", "return void 0"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected output with passes disabled to contain %q", want)
+		}
+	}
+}
+
+func TestDecoderCallArguments(t *testing.T) {
+	code, result, err := deobfuscateFixture(t, fixtureScript(t, `
+var ko = {'k': 400, 'z': 2};
+var fd2;
+fd2 = b;
+function wr(x, y) { return b(x - 312, y) }
+var wv = function(x) { return fd2(x + 5) };
+var out = [b(417 - 10, 'k'), wr(721, 'zz'), b(ko.k + 10), wv(407), b(window.q), wr(sideEffect())];
+`), visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+
+	want := `var out = ["charAt", "push", "length", "POST", b(window.q), wr(sideEffect())];`
+	if !strings.Contains(code, want) {
+		t.Errorf("expected output to contain %q", want)
+	}
+	if result.UnresolvedDecoderCalls != 2 {
+		t.Errorf("expected 2 unresolved decoder calls, got %d", result.UnresolvedDecoderCalls)
+	}
+
+	// Scope contexts left by an earlier resolution do not hide the decoder's reassigned locals.
+	prog := parseFixture(t, fixtureScript(t, "\nvar out2 = [b(407, 'k')];"))
+	resolver.Resolve(prog)
+	if _, err := visitors.DeobfuscateCf(prog); err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+	if code := fastgen.Generate(prog); !strings.Contains(code, `var out2 = ["charAt"];`) {
+		t.Error("expected the two-argument call on a resolved program to be decoded")
+	}
+}
+
+func TestDeobfuscateMetrics(t *testing.T) {
+	extra := `
+var ko = {'k': 400, 'z': 2};
+var out = [ko[window.k], ko.missing, 5 | 3, b(window.q), b(window.r)];
+`
+	_, result, err := deobfuscateFixture(t, fixtureScript(t, extra), visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+
+	if result.UnresolvedDecoderCalls != 2 {
+		t.Errorf("expected 2 unresolved decoder calls, got %d", result.UnresolvedDecoderCalls)
+	}
+	if result.UnresolvedConstantLookups != 2 {
+		t.Errorf("expected 2 unresolved constant lookups, got %d", result.UnresolvedConstantLookups)
+	}
+	if result.UnfoldedNumericExpressions != 1 {
+		t.Errorf("expected 1 unfolded numeric expression, got %d", result.UnfoldedNumericExpressions)
+	}
+	if result.ResolvedDecoderCalls == 0 || result.StringTableCoverage <= 0 || result.StringTableCoverage > 1 {
+		t.Errorf("unexpected resolution metrics: %d resolved, %.2f coverage", result.ResolvedDecoderCalls, result.StringTableCoverage)
+	}
+
+	opts := visitors.DefaultOptions()
+	opts.Quality.MaxUnresolvedConstantLookups = 1
+	if _, _, err := deobfuscateFixture(t, fixtureScript(t, extra), opts); err == nil || !strings.Contains(err.Error(), "constant-object lookups") {
+		t.Errorf("expected quality gate to reject output, got %v", err)
+	}
+}
+
+func TestRotationIndexMap(t *testing.T) {
+	src := fixtureScript(t, "")
+	rotation := strings.NewReplacer(
+		"for(fe=b,", "for(fe=b,qz={'a':408,'b':411,'tag':'x'},",
+		"parseInt(fe(408))", "parseInt(fe(qz.a))",
+		"parseInt(fe(411))", "parseInt(fe(qz['b']))",
+	)
+
+	for _, tc := range []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{"renamed index map", rotation.Replace(src), ""},
+		{"missing index map key", strings.Replace(rotation.Replace(src), "fe(qz.a)", "fe(qz.zz)", 1), "defines b, zz as table indices"},
+		{"missing target", strings.Replace(src, "(a,1285613)", "(a,12)", 1), "could not extract rotation target"},
+		{"unmatched target", strings.Replace(src, "(a,1285613)", "(a,1285614)", 1), "did not finish within"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, err := deobfuscateFixture(t, tc.src, visitors.DefaultOptions())
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Deobfuscation failed: %v", err)
+				}
+				if !strings.Contains(code, `i.open("POST"`) {
+					t.Error("expected the string table to be rotated correctly")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRotationEvaluator(t *testing.T) {
+	src := fixtureScript(t, "")
+	helper := strings.NewReplacer(
+		"function(c,d,fe,e,f){for(fe=b,", "function(c,d,fe,e,f,h){for(fe=b,h=function(x){return parseInt(fe(x))},",
+		"parseInt(fe(408))/1", "h(408)/1",
+	)
+	modulo := strings.NewReplacer(
+		"-parseInt(fe(446))/9,", "-parseInt(fe(446))/9+d%100-13,",
+		"(a,1285613)", "(a,1285620)",
+	)
+
+	for _, tc := range []struct {
+		name    string
+		src     string
+		budget  int
+		wantErr string
+	}{
+		{"helper function", helper.Replace(src), 0, ""},
+		{"modulo in checksum", modulo.Replace(src), 0, ""},
+		{"step budget", src, 50, "did not finish within 50 evaluation steps"},
+		{"unmodeled global", strings.Replace(src, "e=c();", "e=c(),Math.random();", 1), 0, "reads Math"},
+		{"expression fallback", strings.Replace(strings.Replace(src, "fd=b,function(c,d,fe,e,f)", "fd=b,(0,function(c,d,fe,e,f)", 1), "}(a,1285613)", "})(a,1285613)", 1), 0, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := visitors.DefaultOptions()
+			opts.RotationStepBudget = tc.budget
+			code, _, err := deobfuscateFixture(t, tc.src, opts)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Deobfuscation failed: %v", err)
+				}
+				if !strings.Contains(code, `i.open("POST"`) {
+					t.Error("expected the string table to be rotated correctly")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEngineFallback(t *testing.T) {
+	const alphabet = "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
+	src := fixtureScript(t, "")
+	computedTarget := strings.Replace(src, "(a,1285613)", "(a,1285e3+613)", 1)
+	charFn := "return'" + alphabet + "'[fd(gl.xKp)](i)"
+	_, static, err := deobfuscateFixture(t, src, visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+	if static.StringTableCoverage >= 1 {
+		t.Fatal("expected the fixture to have string-table entries no call refers to")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		src        string
+		engine     visitors.EngineOptions
+		wantEngine bool
+		wantErr    string
+	}{
+		{"static only", computedTarget, visitors.EngineOptions{}, false, "could not extract rotation target"},
+		{"static fails", computedTarget, visitors.EngineOptions{Enabled: true}, true, ""},
+		{"cross-checked", src, visitors.EngineOptions{Enabled: true}, false, ""},
+		{"cross-check mismatch", strings.Replace(src, "h=e[f],h}", "h=e[f]+'x',h}", 1), visitors.EngineOptions{Enabled: true}, false, "statically but to"},
+		{"engine timeout", strings.Replace(src, "(a,1285613)", "(a,1285e3+614)", 1), visitors.EngineOptions{Enabled: true, Timeout: 50 * time.Millisecond}, false, "engine fallback: rotation IIFE: did not finish within 50ms"},
+		// The alphabet is read with a split the static extractor does not follow.
+		{"alphabet from engine", strings.Replace(src, charFn, "return'"+alphabet+"'.split('')[i]", 1), visitors.EngineOptions{Enabled: true}, false, ""},
+		{"alphabet mismatch", strings.Replace(src, charFn, "return'"+alphabet+"'[fd(gl.xKp)](i^1)", 1), visitors.EngineOptions{Enabled: true}, false, "statically but"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := visitors.DefaultOptions()
+			opts.Engine = tc.engine
+			code, result, err := deobfuscateFixture(t, tc.src, opts)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Deobfuscation failed: %v", err)
+			}
+			if result.StringsFromEngine != tc.wantEngine {
+				t.Errorf("StringsFromEngine = %v, want %v", result.StringsFromEngine, tc.wantEngine)
+			}
+			// The engine decodes the whole table, not only the entries the script calls for.
+			if result.StringTableCoverage != static.StringTableCoverage {
+				t.Errorf("StringTableCoverage = %v, want %v", result.StringTableCoverage, static.StringTableCoverage)
+			}
+			if !strings.Contains(code, `i.open("POST"`) {
+				t.Error("expected the decoded strings to be substituted")
+			}
+			if result.LZAlphabet != alphabet {
+				t.Errorf("LZAlphabet = %q, want %q", result.LZAlphabet, alphabet)
+			}
+		})
+	}
+}
+
+func TestLZAlphabetInArrowFunction(t *testing.T) {
+	const alphabet = "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
+	src := strings.Replace(fixtureScript(t, ""), "function(i){return'"+alphabet+"'[fd(gl.xKp)](i)}", "i=>'"+alphabet+"'[fd(gl.xKp)](i)", 1)
+	_, result, err := deobfuscateFixture(t, src, visitors.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+	if result.LZAlphabet != alphabet {
+		t.Errorf("LZAlphabet = %q, want %q", result.LZAlphabet, alphabet)
+	}
+}
+
+func TestLZAlphabetDiscovery(t *testing.T) {
+	const alphabet = "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
+	charFn := "function(i){return'" + alphabet + "'[fd(gl.xKp)](i)}"
+	src := fixtureScript(t, "")
+
+	for _, tc := range []struct {
+		name           string
+		src            string
+		wantCompressor string
+		wantLookup     string
+		wantErr        string
+	}{
+		{"literal", src, "gp", "charAt", ""},
+		{"variable", strings.Replace(src, charFn, "function(i){return lzA.charAt(i)}", 1) + ";var lzA='" + alphabet + "'", "gp", "charAt", ""},
+		{"bracket indexing", strings.Replace(src, charFn, "function(i){return lzA[i]}", 1) + ";var lzA='" + alphabet + "'", "gp", "index", ""},
+		{"concatenated pieces", strings.Replace(src, charFn, "function(i){return lzA[i]}", 1) + ";var lzA='" + alphabet[:20] + "'+lzB,lzB='" + alphabet[20:] + "'", "gp", "index", ""},
+		{"named character function", strings.Replace(src, charFn, "lzC", 1) + ";function lzC(i){return'" + alphabet + "'.charAt(i)}", "gp", "charAt", ""},
+		{"indexOf scan", strings.Replace(src, charFn, "function(i){return String.fromCharCode(i+32)}", 1) + ";function lzD(c){return'" + alphabet + "'.indexOf(c)}", "", "indexOf", ""},
+		{"wrong length", strings.Replace(src, alphabet, alphabet[2:], 1), "", "", "has 63 characters, want 64 or 65"},
+		{"repeated character", strings.Replace(src, alphabet, "M"+alphabet[1:64]+"M", 1), "", "", `repeats 'M'`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, result, err := deobfuscateFixture(t, tc.src, visitors.DefaultOptions())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Deobfuscation failed: %v", err)
+			}
+			if result.LZAlphabet != alphabet {
+				t.Errorf("LZAlphabet = %q, want %q", result.LZAlphabet, alphabet)
+			}
+			source := result.LZAlphabetSource
+			if source.Compressor != tc.wantCompressor || source.Lookup != tc.wantLookup {
+				t.Errorf("found by %s, want compressor %q and lookup %q", source, tc.wantCompressor, tc.wantLookup)
+			}
+			if source.Offset < 0 || source.Offset >= len(tc.src) {
+				t.Errorf("offset %d is outside the script", source.Offset)
+			}
+		})
+	}
+}
+
+func TestEncodedStringTables(t *testing.T) {
+	for _, fixture := range []string{"main_base64.js", "main_rc4.js"} {
+		t.Run(fixture, func(t *testing.T) {
+			src, err := os.ReadFile("testdata/" + fixture)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			code, result, err := deobfuscateFixture(t, string(src), visitors.DefaultOptions())
+			if err != nil {
+				t.Fatalf("Deobfuscation failed: %v", err)
+			}
+			if result.UnresolvedDecoderCalls != 0 {
+				t.Errorf("%d decoder calls left unresolved", result.UnresolvedDecoderCalls)
+			}
+			for _, want := range []string{`i.open("POST"`, `i.setRequestHeader("Content-Type"`} {
+				if !strings.Contains(code, want) {
+					t.Errorf("expected the decoded output to contain %s", want)
+				}
+			}
+			if result.LZAlphabet != "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN" {
+				t.Errorf("LZAlphabet = %q", result.LZAlphabet)
+			}
+		})
+	}
+}
+
+func TestMultipleStringTables(t *testing.T) {
+	module, err := os.ReadFile("testdata/second_module.js")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	src := fixtureScript(t, "\n"+string(module))
+
+	t.Run("resolved per group", func(t *testing.T) {
+		code, result, err := deobfuscateFixture(t, src, visitors.DefaultOptions())
+		if err != nil {
+			t.Fatalf("Deobfuscation failed: %v", err)
+		}
+		if result.StringTables != 2 {
+			t.Errorf("StringTables = %d, want 2", result.StringTables)
+		}
+		if result.UnresolvedDecoderCalls != 0 {
+			t.Errorf("%d decoder calls left unresolved", result.UnresolvedDecoderCalls)
+		}
+		for _, want := range []string{`i.open("POST"`, `document.body.dataset["data-id"] = "second module"`, `window.title = "ready"`} {
+			if !strings.Contains(code, want) {
+				t.Errorf("expected the decoded output to contain %s", want)
+			}
+		}
+	})
+
+	t.Run("renamed", func(t *testing.T) {
+		code, _, err := deobfuscateFixture(t, src, visitors.Options{RenameIdentifiers: true})
+		if err != nil {
+			t.Fatalf("Deobfuscation failed: %v", err)
+		}
+		for _, want := range []string{"function decoder(", "function stringTable(", "function decoder2(", "function stringTable2("} {
+			if !strings.Contains(code, want) {
+				t.Errorf("expected renamed output to contain %q", want)
+			}
+		}
+	})
+
+	// A failing group is named in the error, with its position only when the source is known.
+	broken := strings.Replace(src, "(y,112049)", "(y,112049+x)", 1)
+	for _, tc := range []struct {
+		name   string
+		source *visitors.SourceFile
+		want   string
+	}{
+		{"failing group", nil, "decoder z: "},
+		{"failing group with source", visitors.NewSourceFile("main.js", broken), "line 17, column 1: decoder z: "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := visitors.DefaultOptions()
+			opts.Source = tc.source
+			_, _, err := deobfuscateFixture(t, broken, opts)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("expected error starting with %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	render := func(t *testing.T, src string) (*ast.Program, string) {
+		t.Helper()
+		prog := parseFixture(t, src)
+		if _, err := visitors.DeobfuscateCf(prog); err != nil {
+			t.Fatalf("Deobfuscation failed: %v", err)
+		}
+		return prog, fastgen.Generate(prog)
+	}
+
+	for _, fixture := range []string{"main.js", "main_base64.js", "main_rc4.js"} {
+		t.Run(fixture, func(t *testing.T) {
+			src, err := os.ReadFile("testdata/" + fixture)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			prog, code := render(t, string(src))
+			if err := visitors.ValidateOutput(prog, code); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Number literals are read back with the rules of the JS lexer.
+	t.Run("number literal forms", func(t *testing.T) {
+		prog, code := render(t, fixtureScript(t, "\nx=[010,0x1ffffffffffffffff,1e400,.5];"))
+		if err := visitors.ValidateOutput(prog, code); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		tamper  func(*ast.Program) string
+		wantErr string
+	}{
+		{"NaN literal", func(p *ast.Program) string {
+			p.Body = append(p.Body, ast.Statement{Stmt: &ast.ExpressionStatement{Expression: &ast.Expression{Expr: &ast.NumberLiteral{Value: math.NaN()}}}})
+			return fastgen.Generate(p)
+		}, "number literal NaN has no literal form"},
+		{"negative zero", func(p *ast.Program) string {
+			p.Body = append(p.Body, ast.Statement{Stmt: &ast.ExpressionStatement{Expression: &ast.Expression{Expr: &ast.NumberLiteral{Value: math.Copysign(0, -1)}}}})
+			return fastgen.Generate(p)
+		}, "number literal -0 has no literal form"},
+		{"stale raw text", func(p *ast.Program) string {
+			raw := "0x10"
+			p.Body = append(p.Body, ast.Statement{Stmt: &ast.ExpressionStatement{Expression: &ast.Expression{Expr: &ast.NumberLiteral{Value: 17, Raw: &raw}}}})
+			return fastgen.Generate(p)
+		}, "prints as 0x10 but holds 17"},
+		{"escape without a JS form", func(p *ast.Program) string {
+			p.Body = append(p.Body, ast.Statement{Stmt: &ast.ExpressionStatement{Expression: &ast.Expression{Expr: &ast.StringLiteral{Value: "\a"}}}})
+			return fastgen.Generate(p)
+		}, `reads back as "a", want "\a"`},
+		{"unparseable output", func(p *ast.Program) string {
+			return fastgen.Generate(p) + "\n}"
+		}, "generated code does not parse"},
+		{"dropped statement", func(p *ast.Program) string {
+			code := fastgen.Generate(p)
+			p.Body = append(p.Body, ast.Statement{Stmt: &ast.EmptyStatement{}})
+			return code
+		}, "top-level statements"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prog, _ := render(t, fixtureScript(t, ""))
+			err := visitors.ValidateOutput(prog, tc.tamper(prog))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// decodeMappings expands the mappings of a single-source map into generated line and column to
+// original line and column, all zero-based.
+func decodeMappings(t *testing.T, mappings string) map[[2]int][2]int {
+	t.Helper()
+	const digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	segments := make(map[[2]int][2]int)
+	var line, col int
+	for genLine, group := range strings.Split(mappings, ";") {
+		genCol := 0
+		for _, seg := range strings.Split(group, ",") {
+			if seg == "" {
+				continue
+			}
+			var fields []int
+			for v, shift, i := 0, 0, 0; i < len(seg); i++ {
+				d := strings.IndexByte(digits, seg[i])
+				v |= (d & 31) << shift
+				shift += 5
+				if d&32 == 0 {
+					if v&1 == 1 {
+						v = -(v >> 1)
+					} else {
+						v >>= 1
+					}
+					fields = append(fields, v)
+					v, shift = 0, 0
+				}
+			}
+			if len(fields) != 4 {
+				t.Fatalf("segment %q has %d fields", seg, len(fields))
+			}
+			genCol += fields[0]
+			line += fields[2]
+			col += fields[3]
+			segments[[2]int{genLine, genCol}] = [2]int{line, col}
+		}
+	}
+	return segments
+}
+
+func TestSourcePositions(t *testing.T) {
+	src := fixtureScript(t, "")
+
+	t.Run("source map", func(t *testing.T) {
+		prog := parseFixture(t, src)
+		file := visitors.NewSourceFile("main.js", src)
+		opts := visitors.DefaultOptions()
+		opts.Source = file
+		if _, err := visitors.DeobfuscateCfWithOptions(prog, opts); err != nil {
+			t.Fatalf("Deobfuscation failed: %v", err)
+		}
+		code, sm, err := visitors.GenerateWithSourceMap(prog, file, "main.deobf.js")
+		if err != nil {
+			t.Fatalf("GenerateWithSourceMap failed: %v", err)
+		}
+		if sm.Version != 3 || len(sm.Sources) != 1 || sm.Sources[0] != "main.js" {
+			t.Errorf("unexpected map header %+v", sm)
+		}
+
+		segments := decodeMappings(t, sm.Mappings)
+		lines := strings.Split(src, "\n")
+		// The decoded "POST" sits where the script called the decoder for it.
+		idx := strings.Index(code, `"POST"`)
+		genLine := strings.Count(code[:idx], "\n")
+		genCol := idx - strings.LastIndex(code[:idx], "\n") - 1
+		orig, ok := segments[[2]int{genLine, genCol}]
+		if !ok {
+			t.Fatalf("no mapping for the \"POST\" literal at %d:%d", genLine, genCol)
+		}
+		if got := lines[orig[0]][orig[1]:]; !strings.HasPrefix(got, "fd(412)") {
+			t.Errorf("\"POST\" maps to %.20q, want the decoder call fd(412)", got)
+		}
+	})
+
+	t.Run("error position", func(t *testing.T) {
+		bad := strings.Replace(src, "e=c();", "e=c(),Math.random();", 1)
+		opts := visitors.DefaultOptions()
+		opts.Source = visitors.NewSourceFile("main.js", bad)
+		_, _, err := deobfuscateFixture(t, bad, opts)
+		var posErr *visitors.PositionError
+		if !errors.As(err, &posErr) || posErr.Pos.Line != 3 {
+			t.Fatalf("expected an error on line 3, got %v", err)
+		}
+		if want := "line 3, column 27: code reads Math"; !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	})
+
+	// A step that fails without a node of its own is reported at the decoder.
+	t.Run("decoder position", func(t *testing.T) {
+		bad := strings.Replace(src, "(a,1285613)", "(a,12)", 1)
+		opts := visitors.DefaultOptions()
+		opts.Source = visitors.NewSourceFile("main.js", bad)
+		_, _, err := deobfuscateFixture(t, bad, opts)
+		var posErr *visitors.PositionError
+		if !errors.As(err, &posErr) || posErr.Pos.Line != 12 || !strings.Contains(err.Error(), "could not extract rotation target") {
+			t.Fatalf("expected the rotation target error on line 12, got %v", err)
+		}
+	})
+
+	t.Run("alphabet mismatch position", func(t *testing.T) {
+		const alphabet = "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
+		bad := strings.Replace(src, "return'"+alphabet+"'[fd(gl.xKp)](i)", "return'"+alphabet+"'[fd(gl.xKp)](i^1)", 1)
+		opts := visitors.DefaultOptions()
+		opts.Engine.Enabled = true
+		opts.Source = visitors.NewSourceFile("main.js", bad)
+		_, _, err := deobfuscateFixture(t, bad, opts)
+		var posErr *visitors.PositionError
+		if !errors.As(err, &posErr) || !strings.Contains(err.Error(), "statically but") {
+			t.Fatalf("expected a positioned alphabet mismatch, got %v", err)
+		}
+	})
+}
+
+func TestScriptSignature(t *testing.T) {
+	src := fixtureScript(t, "")
+	signature := func(t *testing.T, src string) string {
+		t.Helper()
+		return visitors.ScriptSignature(parseFixture(t, src))
+	}
+	base := signature(t, src)
+
+	// A rebuild mangles names afresh, reshuffles the table and reorders lookup objects.
+	table := regexp.MustCompile(`gs='([^']*)'`).FindStringSubmatch(src)[1]
+	entries := strings.Split(table, ",")
+	slices.Reverse(entries)
+	rebuilt := strings.Replace(src, table, strings.Join(entries, ","), 1)
+	rebuilt = regexp.MustCompile(`\bgl\b`).ReplaceAllString(rebuilt, "qx")
+	rebuilt = strings.Replace(rebuilt, "{'xKp':407,'Hwq':441,'rTz':442}", "{'rTz':442,'xKp':407,'Hwq':441}", 1)
+	if rebuilt == src {
+		t.Fatal("rebuild left the fixture unchanged")
+	}
+	if got := signature(t, rebuilt); got != base {
+		t.Errorf("rebuilt script has signature %s, want %s", got, base)
+	}
+
+	if got := signature(t, src+"\nwindow.extra=1;"); got == base {
+		t.Error("an added statement did not change the signature")
+	}
+
+	registry := visitors.NewVariantRegistry(visitors.Variant{Signature: base, Name: "fixture"})
+	var buf bytes.Buffer
+	if err := registry.Save(&buf); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := visitors.LoadVariantRegistry(&buf)
+	if err != nil {
+		t.Fatalf("LoadVariantRegistry failed: %v", err)
+	}
+
+	opts := visitors.DefaultOptions()
+	opts.Variants = loaded
+	_, result, err := deobfuscateFixture(t, src, opts)
+	if err != nil {
+		t.Fatalf("Deobfuscation failed: %v", err)
+	}
+	if result.Signature != base || !result.KnownVariant || result.Variant.Name != "fixture" {
+		t.Errorf("expected the fixture variant, got signature %s, known %v, variant %+v", result.Signature, result.KnownVariant, result.Variant)
+	}
+
+	if _, err := visitors.LoadVariantRegistry(strings.NewReader(`[{"name":"unsigned"}]`)); err == nil {
+		t.Error("expected an error for a variant without a signature")
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	src := fixtureScript(t, "")
+	for _, tc := range []struct {
+		name   string
+		limits visitors.Limits
+		want   visitors.LimitKind
+	}{
+		{"nodes", visitors.Limits{MaxNodes: 100}, visitors.LimitNodes},
+		{"steps", visitors.Limits{MaxSteps: 50}, visitors.LimitSteps},
+		{"time", visitors.Limits{Timeout: time.Nanosecond}, visitors.LimitTime},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := visitors.DefaultOptions()
+			opts.Limits = tc.limits
+			_, _, err := deobfuscateFixture(t, src, opts)
+			var limit *visitors.LimitError
+			if !errors.As(err, &limit) || limit.Kind != tc.want {
+				t.Fatalf("expected a %v limit error, got %v", tc.want, err)
+			}
+		})
+	}
+
+	t.Run("script size", func(t *testing.T) {
+		limits := visitors.Limits{MaxScriptBytes: int64(len(src) - 1)}
+		var limit *visitors.LimitError
+		if err := limits.CheckScriptSize(int64(len(src))); !errors.As(err, &limit) || limit.Kind != visitors.LimitScriptSize {
+			t.Errorf("expected a script size limit error, got %v", err)
+		}
+		if err := visitors.DefaultLimits().CheckScriptSize(int64(len(src))); err != nil {
+			t.Errorf("fixture exceeds the default limits: %v", err)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fxnatic/jsd-solver-go/solver"
+)
+
+func TestDiffScripts(t *testing.T) {
+	old := fixtureScript(t, "\nwindow.probes=['n.webdriver','d.hidden'];function check(){return navigator.userAgent}")
+
+	// A rebuild with fresh mangling, a new oneshot path, an edited probe list, a function
+	// reading another property and one new function.
+	cur := strings.ReplaceAll(fixtureScript(t, ""), "93954b626b88", "aaaabbbbcccc")
+	cur = regexp.MustCompile(`\bgl\b`).ReplaceAllString(cur, "qx")
+	cur += "\nwindow.probes=['n.webdriver','n.gpu'];function check(){return navigator.platform}function extra(a){return a.length}"
+
+	t.Run("identical", func(t *testing.T) {
+		d, err := solver.DiffScripts(old, old)
+		if err != nil {
+			t.Fatalf("DiffScripts failed: %v", err)
+		}
+		if !d.Empty() || d.String() != "no changes\n" {
+			t.Errorf("expected no changes, got:\n%s", d)
+		}
+	})
+
+	d, err := solver.DiffScripts(old, cur)
+	if err != nil {
+		t.Fatalf("DiffScripts failed: %v", err)
+	}
+
+	if d.OneshotPath == nil || !strings.HasPrefix(d.OneshotPath.New, "aaaabbbbcccc/") {
+		t.Errorf("expected the new oneshot path, got %+v", d.OneshotPath)
+	}
+	if d.LZAlphabet != nil || d.Sitekey != nil {
+		t.Errorf("unexpected alphabet or sitekey change: %+v %+v", d.LZAlphabet, d.Sitekey)
+	}
+	if len(d.StringTables) != 1 || !slices.Equal(d.StringTables[0].Added, []string{"/jsd/oneshot/aaaabbbbcccc/0.4164:1762786823:"}) {
+		t.Errorf("unexpected string table changes %+v", d.StringTables)
+	}
+
+	if len(d.AddedFunctions) != 1 || d.AddedFunctions[0].Params != 1 || len(d.RemovedFunctions) != 0 {
+		t.Errorf("expected one added function, got added %+v, removed %+v", d.AddedFunctions, d.RemovedFunctions)
+	}
+	// check reads another property, and the function sending the oneshot request another path.
+	if len(d.ChangedFunctions) != 2 {
+		t.Errorf("expected two changed functions, got %+v", d.ChangedFunctions)
+	}
+
+	if len(d.ProbeLists) != 1 || !slices.Equal(d.ProbeLists[0].Added, []string{"n.gpu"}) || !slices.Equal(d.ProbeLists[0].Removed, []string{"d.hidden"}) {
+		t.Errorf("unexpected probe list changes %+v", d.ProbeLists)
+	}
+
+	text := d.String()
+	for _, want := range []string{"oneshot path:", "functions: 1 added, 0 removed, 2 changed", `+ "n.gpu"`, `- "d.hidden"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report is missing %q:\n%s", want, text)
+		}
+	}
+
+	var decoded map[string]any
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"oneshot_path", "string_tables", "added_functions", "changed_functions", "probe_lists"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("JSON report is missing %q: %s", key, b)
+		}
+	}
+}
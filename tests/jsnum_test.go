@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fxnatic/jsd-solver-go/jsnum"
+)
+
+// sameNumber is Object.is for doubles: NaN equals NaN and 0 differs from -0.
+func sameNumber(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return a == b && math.Signbit(a) == math.Signbit(b)
+}
+
+// The expected values below were produced by Node 20 (V8).
+
+func TestParseInt(t *testing.T) {
+	nan, negZero := math.NaN(), math.Copysign(0, -1)
+	for _, tc := range []struct {
+		in    string
+		radix int32
+		want  float64
+	}{
+		{"  42px", 0, 42},
+		{"  42px", 16, 66},
+		{"  42px", 2, nan},
+		{"+0x1F", 0, 31},
+		{"+0x1F", 16, 31},
+		{"+0x1F", 2, 0},
+		{"-0x10", 0, -16},
+		{"-0x10", 2, negZero},
+		{"0x10", 10, 0},
+		{"0x", 0, nan},
+		{"0x", 16, nan},
+		{"abc", 0, nan},
+		{"abc", 16, 2748},
+		{"", 0, nan},
+		{"-0", 0, negZero},
+		{"9007199254740993", 0, 9007199254740992},
+		{"9007199254740993", 16, 10378291982571407000},
+		{"123456789012345678901234567890", 0, 1.2345678901234568e+29},
+		{"123456789012345678901234567890", 16, 9.452287968736547e+34},
+		{"1e3", 0, 1},
+		{"1e3", 16, 483},
+		{" -12.7", 0, -12},
+		{" -12.7", 16, -18},
+		{"z", 36, 35},
+		{"10", 37, nan},
+		{"10", 1, nan},
+	} {
+		if got := jsnum.ParseInt(tc.in, tc.radix); !sameNumber(got, tc.want) {
+			t.Errorf("ParseInt(%q, %d) = %v, want %v", tc.in, tc.radix, got, tc.want)
+		}
+	}
+}
+
+func TestParseFloatAndToNumber(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, tc := range []struct {
+		in                   string
+		parseFloat, toNumber float64
+	}{
+		{"  42px", 42, nan},
+		{"+0x1F", 0, nan},
+		{"0x", 0, nan},
+		{"abc", nan, nan},
+		{"", nan, 0},
+		{"9007199254740993", 9007199254740992, 9007199254740992},
+		{"1e3", 1000, 1000},
+		{" -12.7", -12.7, -12.7},
+		{"  7", 7, 7},
+		{"1.e5", 100000, 100000},
+		{"-Infinityx", math.Inf(-1), nan},
+		{" Infinity ", inf, inf},
+		{".5e-3x", 0.0005, nan},
+		{"0b101", 0, 5},
+		{"0o17", 0, 15},
+		{"0x1f", 0, 31},
+		{"1_0", 1, nan},
+		{"1e400", inf, inf},
+	} {
+		if got := jsnum.ParseFloat(tc.in); !sameNumber(got, tc.parseFloat) {
+			t.Errorf("ParseFloat(%q) = %v, want %v", tc.in, got, tc.parseFloat)
+		}
+		if got := jsnum.ToNumber(tc.in); !sameNumber(got, tc.toNumber) {
+			t.Errorf("ToNumber(%q) = %v, want %v", tc.in, got, tc.toNumber)
+		}
+	}
+}
+
+func TestToInt32(t *testing.T) {
+	for _, tc := range []struct {
+		in     float64
+		int32  int32
+		uint32 uint32
+	}{
+		{1<<32 + 5, 5, 5},
+		{-1, -1, 4294967295},
+		{-(1 << 31) - 1, 2147483647, 2147483647},
+		{1e21, -559939584, 3735027712},
+		{math.NaN(), 0, 0},
+		{math.Inf(-1), 0, 0},
+		{4294967296.7, 0, 0},
+		{-4294967297.5, -1, 4294967295},
+	} {
+		if got := jsnum.ToInt32(tc.in); got != tc.int32 {
+			t.Errorf("ToInt32(%v) = %d, want %d", tc.in, got, tc.int32)
+		}
+		if got := jsnum.ToUint32(tc.in); got != tc.uint32 {
+			t.Errorf("ToUint32(%v) = %d, want %d", tc.in, got, tc.uint32)
+		}
+	}
+}
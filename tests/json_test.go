@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/fxnatic/jsd-solver-go/utils"
+	"github.com/iancoleman/orderedmap"
+)
+
+type flag bool
+
+// TestJSONStringifyConformance compares against JSON.stringify output from Node 20 (V8).
+func TestJSONStringifyConformance(t *testing.T) {
+	ordered := orderedmap.New()
+	ordered.Set("b", 1)
+	ordered.Set("10", 2)
+	ordered.Set("a", 3)
+	ordered.Set("2", 4)
+	ordered.Set("01", 5)
+	ordered.Set("4294967295", 6)
+	ordered.Set("4294967294", 7)
+	ordered.Set("-1", 8)
+
+	nested := orderedmap.New()
+	nested.Set("t", int64(1762786823))
+	nested.Set("lhr", "about:blank")
+	nested.Set("api", false)
+	nested.Set("payload", map[string]any{"o": []string{"window", "n.gpu"}, "1392": []string{"outerHeight"}})
+
+	for _, tc := range []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"null", nil, `null`},
+		{"true", true, `true`},
+		{"zero", 0, `0`},
+		{"negative zero", math.Copysign(0, -1), `0`},
+		{"negative int", -1, `-1`},
+		{"tenth", 0.1, `0.1`},
+		{"decimal", 123.456, `123.456`},
+		{"1e21", 1e21, `1e+21`},
+		{"1e20", 1e20, `100000000000000000000`},
+		{"large plain", 123456789012345680000.0, `123456789012345680000`},
+		{"1e-6", 1e-6, `0.000001`},
+		{"1e-7", 1e-7, `1e-7`},
+		{"small exponent", 1.5e-7, `1.5e-7`},
+		{"negative small", -2.5e-10, `-2.5e-10`},
+		{"max float", math.MaxFloat64, `1.7976931348623157e+308`},
+		{"min subnormal", 5e-324, `5e-324`},
+		{"beyond 2^53", int64(9007199254740993), `9007199254740992`},
+		{"timestamp", int64(1762786823), `1762786823`},
+		{"third", 1.0 / 3, `0.3333333333333333`},
+		{"small digits", 0.000001234, `0.000001234`},
+		{"large exponent", 12345678901234567890123.0, `1.2345678901234568e+22`},
+		{"NaN", math.NaN(), `null`},
+		{"infinity", math.Inf(1), `null`},
+		{"string escapes", "a\"b\\c\b\f\n\r\t\x01\x1f\x7f<>&  é😀/", "\"a\\\"b\\\\c\\b\\f\\n\\r\\t\\u0001\\u001f\x7f<>&  é😀/\""},
+		{"array", []any{1, "x", nil, []int{}}, `[1,"x",null,[]]`},
+		{"named string and bool", []any{json.Number("12"), flag(true)}, `["12",true]`},
+		{"key order", ordered, `{"2":4,"10":2,"4294967294":7,"b":1,"a":3,"01":5,"4294967295":6,"-1":8}`},
+		{"payload", nested, `{"t":1762786823,"lhr":"about:blank","api":false,"payload":{"1392":["outerHeight"],"o":["window","n.gpu"]}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := utils.JSONStringify(tc.value)
+			if err != nil {
+				t.Fatalf("JSONStringify failed: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("JSONStringify = %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := utils.JSONStringify(func() {}); err == nil {
+		t.Error("expected an error for a function value")
+	}
+}
@@ -0,0 +1,278 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/fxnatic/jsd-solver-go/utils"
+)
+
+const (
+	base64Alphabet  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+	uriSafeAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+-$"
+)
+
+// lzCase is one entry of testdata/lz_corpus.json, generated with lz-string 1.5.0 under Node.
+// Inputs are stored as UTF-16 code units so lone surrogates survive the round trip.
+type lzCase struct {
+	Name   string   `json:"name"`
+	Units  []uint16 `json:"units"`
+	Base64 string   `json:"base64"`
+	Raw    []uint16 `json:"raw"`
+	UTF16  []uint16 `json:"utf16"`
+	Uint8  []byte   `json:"uint8"`
+	URI    string   `json:"uri"`
+}
+
+func loadLZCorpus(t *testing.T) []lzCase {
+	t.Helper()
+	data, err := os.ReadFile("testdata/lz_corpus.json")
+	if err != nil {
+		t.Fatalf("Failed to read corpus: %v", err)
+	}
+	var cases []lzCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("Failed to parse corpus: %v", err)
+	}
+	return cases
+}
+
+func isWellFormedUTF16(units []uint16) bool {
+	return slices.Equal(utf16.Encode(utf16.Decode(units)), units)
+}
+
+func TestLZStringReferenceParity(t *testing.T) {
+	lz := utils.NewLZString(base64Alphabet)
+
+	for _, tc := range loadLZCorpus(t) {
+		t.Run(tc.Name, func(t *testing.T) {
+			if got := lz.CompressUnitsToBase64(tc.Units); got != tc.Base64 {
+				t.Errorf("CompressUnitsToBase64 = %q, want %q", got, tc.Base64)
+			}
+			if got := lz.DecompressUnitsFromBase64(tc.Base64); !slices.Equal(got, tc.Units) {
+				t.Errorf("DecompressUnitsFromBase64 = %v, want %v", got, tc.Units)
+			}
+
+			if !isWellFormedUTF16(tc.Units) {
+				return
+			}
+			s := string(utf16.Decode(tc.Units))
+			if got := lz.CompressToBase64(s); got != tc.Base64 {
+				t.Errorf("CompressToBase64 = %q, want %q", got, tc.Base64)
+			}
+			if got := lz.DecompressFromBase64(tc.Base64); got != s {
+				t.Errorf("DecompressFromBase64 = %q, want %q", got, s)
+			}
+		})
+	}
+}
+
+func TestLZStringVariantsParity(t *testing.T) {
+	lz := utils.NewLZString(base64Alphabet)
+	uri := utils.NewLZString(uriSafeAlphabet)
+
+	for _, tc := range loadLZCorpus(t) {
+		if !isWellFormedUTF16(tc.Units) {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			s := string(utf16.Decode(tc.Units))
+
+			if got := lz.Compress(s); !slices.Equal(got, tc.Raw) {
+				t.Errorf("Compress = %v, want %v", got, tc.Raw)
+			}
+			if got := lz.Decompress(tc.Raw); got != s {
+				t.Errorf("Decompress = %q, want %q", got, s)
+			}
+
+			wantUTF16 := string(utf16.Decode(tc.UTF16))
+			if got := lz.CompressToUTF16(s); got != wantUTF16 {
+				t.Errorf("CompressToUTF16 = %q, want %q", got, wantUTF16)
+			}
+			if got := lz.DecompressFromUTF16(wantUTF16); got != s {
+				t.Errorf("DecompressFromUTF16 = %q, want %q", got, s)
+			}
+
+			if got := lz.CompressToUint8Array(s); !slices.Equal(got, tc.Uint8) {
+				t.Errorf("CompressToUint8Array = %v, want %v", got, tc.Uint8)
+			}
+			if got := lz.DecompressFromUint8Array(tc.Uint8); got != s {
+				t.Errorf("DecompressFromUint8Array = %q, want %q", got, s)
+			}
+
+			if got := uri.CompressToEncodedURIComponent(s); got != tc.URI {
+				t.Errorf("CompressToEncodedURIComponent = %q, want %q", got, tc.URI)
+			}
+			if got := uri.DecompressFromEncodedURIComponent(tc.URI); got != s {
+				t.Errorf("DecompressFromEncodedURIComponent = %q, want %q", got, s)
+			}
+		})
+	}
+}
+
+func TestLZStringCustomAlphabet(t *testing.T) {
+	const cfAlphabet = "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
+	lz := utils.NewLZString(cfAlphabet)
+	input := `{"t":1762786823,"lhr":"about:blank","api":false,"payload":{"日本":"😀"}}`
+
+	encoded := lz.CompressToEncodedURIComponent(input)
+	if got := lz.DecompressFromCloudflare(encoded); got != input {
+		t.Errorf("DecompressFromCloudflare = %q, want %q", got, input)
+	}
+	if got := lz.DecompressFromBase64(lz.CompressToBase64(input)); got != input {
+		t.Errorf("base64 round trip = %q, want %q", got, input)
+	}
+}
+
+func TestLZStringDecompressErrors(t *testing.T) {
+	lz := utils.NewLZString(base64Alphabet)
+	valid := lz.CompressToBase64("hello world hello world")
+
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"invalid character", valid[:4] + "!" + valid[5:], utils.ErrInvalidCharacter},
+		{"truncated", valid[:len(valid)/2], utils.ErrTruncatedStream},
+		{"bad reference", "wAAA", utils.ErrBadReference},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := lz.DecompressFromBase64E(tc.input)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("DecompressFromBase64E error = %v, want %v", err, tc.want)
+			}
+			if got != "" {
+				t.Errorf("expected empty result on error, got %q", got)
+			}
+		})
+	}
+
+	if _, err := lz.DecompressFromBase64E(valid[:4] + "!" + valid[5:]); err == nil || !strings.Contains(err.Error(), "offset 4") {
+		t.Errorf("expected error to name offset 4, got %v", err)
+	}
+
+	for _, input := range []string{"", lz.CompressToBase64("")} {
+		if got, err := lz.DecompressFromBase64E(input); err != nil || got != "" {
+			t.Errorf("DecompressFromBase64E(%q) = %q, %v; want empty result and no error", input, got, err)
+		}
+	}
+
+	if _, err := lz.DecompressFromUint8ArrayE([]byte{1, 2, 3}); !errors.Is(err, utils.ErrTruncatedStream) {
+		t.Errorf("expected odd-length byte input to be truncated, got %v", err)
+	}
+}
+
+func TestAlphabet(t *testing.T) {
+	for _, tc := range []struct {
+		chars string
+		want  string
+	}{
+		{base64Alphabet[:64], "65 characters"},
+		{base64Alphabet[:64] + "A", "repeats 'A'"},
+		{base64Alphabet[:63] + "é", "non-ASCII"},
+		{"=" + base64Alphabet[1:64] + "A", "padding character"},
+	} {
+		if _, err := utils.NewAlphabet(tc.chars); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("NewAlphabet(%q) error = %v, want it to mention %q", tc.chars, err, tc.want)
+		}
+	}
+
+	a := utils.CloudflareAlphabet
+	if a.Index('M') != 0 || a.Index('N') != 64 || a.Index('/') != -1 || a.Index(0xff) != -1 {
+		t.Error("unexpected reverse lookup in CloudflareAlphabet")
+	}
+
+	payload := `{"t":1762786823,"api":false}`
+	captured := utils.NewLZStringFromAlphabet(a).CompressToBase64(payload)
+	got, decoded, err := utils.DetectAlphabet(captured, "too short", base64Alphabet, a.String())
+	if err != nil {
+		t.Fatalf("DetectAlphabet failed: %v", err)
+	}
+	if got.String() != a.String() || decoded != payload {
+		t.Errorf("DetectAlphabet = %q, %q; want the Cloudflare alphabet and %q", got, decoded, payload)
+	}
+
+	if _, _, err := utils.DetectAlphabet(captured, base64Alphabet); !errors.Is(err, utils.ErrNoAlphabet) {
+		t.Errorf("expected ErrNoAlphabet, got %v", err)
+	}
+}
+
+func TestEncoderMatchesCompressToBase64(t *testing.T) {
+	lz := utils.NewLZStringFromAlphabet(utils.CloudflareAlphabet)
+
+	inputs := []string{"\xe2\x82", "a\xf0\x90b", string(benchmarkPayload(2000))}
+	for _, tc := range loadLZCorpus(t) {
+		if isWellFormedUTF16(tc.Units) {
+			inputs = append(inputs, string(utf16.Decode(tc.Units)))
+		}
+	}
+
+	for _, input := range inputs {
+		want := lz.CompressToBase64(input)
+
+		for _, chunk := range []int{len(input) + 1, 1, 2, 3, 7} {
+			var out strings.Builder
+			enc := utils.NewEncoder(&out, utils.CloudflareAlphabet)
+			for rest := input; rest != ""; {
+				n := min(chunk, len(rest))
+				if chunk%2 == 0 {
+					enc.WriteString(rest[:n])
+				} else {
+					enc.Write([]byte(rest[:n]))
+				}
+				rest = rest[n:]
+			}
+			if err := enc.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if out.String() != want {
+				t.Errorf("Encoder output for %.20q in %d-byte chunks differs from CompressToBase64", input, chunk)
+			}
+		}
+	}
+}
+
+// benchmarkPayload builds a JSON document shaped like the oneshot fingerprint, about 18 KB for
+// n = 400.
+func benchmarkPayload(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`{"t":1762786823,"lhr":"about:blank","api":false,"payload":{`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `"%d":["n.prop%d","d.NODE_%d","window.él%d"]`, i, i%37, i%11, i%53)
+	}
+	b.WriteString(`}}`)
+	return []byte(b.String())
+}
+
+func BenchmarkCompressToBase64(b *testing.B) {
+	lz := utils.NewLZStringFromAlphabet(utils.CloudflareAlphabet)
+	input := string(benchmarkPayload(400))
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for b.Loop() {
+		lz.CompressToBase64(input)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	input := benchmarkPayload(400)
+	enc := utils.NewEncoder(io.Discard, utils.CloudflareAlphabet)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for b.Loop() {
+		enc.Reset(io.Discard)
+		enc.Write(input)
+		enc.Close()
+	}
+}
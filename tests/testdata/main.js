@@ -0,0 +1,13 @@
+window._cf_chl_opt={cFPWv:'g'};
+~function(fd,gl,gm,gn,go,gp,gq){
+fd=b,function(c,d,fe,e,f){for(fe=b,e=c();!![];)try{if(f=parseInt(fe(408))/1+-parseInt(fe(411))/2+parseInt(fe(415))/3+-parseInt(fe(419))/4+parseInt(fe(423))/5+-parseInt(fe(428))/6+parseInt(fe(433))/7+parseInt(fe(437))/8+-parseInt(fe(446))/9,f===d)break;else e.push(e.shift())}catch(g){e.push(e.shift())}}(a,1285613),
+gl={'xKp':407,'Hwq':441,'rTz':442},
+gm={'UfLqv':function(h,i){return h+i},'oBcMs':function(h,i){return h<i},'kQeYa':function(h,i){return h(i)},'zVwPn':function(h,i){return h==i},'yCm':'abc'},
+gn=function(h,i,j){return h*i-j},
+go=function(h){return h==null?'':gp(h,6,function(i){return'Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN'[fd(gl.xKp)](i)})},
+gp=function(j,k,l,m,n,o,p,q,r,s,t,u,v,w,x,y,z){if(j==null)return'';for(n={},o={},p='',q=2,r=3,s=2,t=[],u=0,v=0,w=0;w<j[fd(410)];w+=1)if(x=j[fd(gl.xKp)](w),Object[fd(444)][fd(445)][fd(447)](n,x)||(n[x]=r++,o[x]=!0),y=p+x,Object[fd(444)][fd(445)][fd(447)](n,y))p=y;else{if(Object[fd(444)][fd(445)][fd(447)](o,p)){if(256>p[fd(gl.rTz)](0)){for(m=0;m<s;u<<=1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,m++);for(z=p[fd(gl.rTz)](0),m=0;8>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);}else{for(z=1,m=0;m<s;u=u<<1|z,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z=0,m++);for(z=p[fd(gl.rTz)](0),m=0;16>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);}q--,0==q&&(q=Math.pow(2,s),s++),delete o[p]}else for(z=n[p],m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);p=(q--,0==q&&(q=Math.pow(2,s),s++),n[y]=r++,String(x))}if(''!==p){if(Object[fd(444)][fd(445)][fd(447)](o,p)){if(256>p[fd(gl.rTz)](0)){for(m=0;m<s;u<<=1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,m++);for(z=p[fd(gl.rTz)](0),m=0;8>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);}else{for(z=1,m=0;m<s;u=u<<1|z,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z=0,m++);for(z=p[fd(gl.rTz)](0),m=0;16>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);}q--,0==q&&(q=Math.pow(2,s),s++),delete o[p]}else for(z=n[p],m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);q--,0==q&&(q=Math.pow(2,s),s++)}for(z=2,m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409)](l(u)),u=0):v++,z>>=1,m++);for(;;)if(u<<=1,v==k-1){t[fd(409)](l(u));break}else v++;return t.join('')},
+gq=function(h,i,j,k){i=new XMLHttpRequest(),j=fd(406),i[fd(421)](fd(412),'/cdn-cgi/challenge-platform/h/'+window._cf_chl_opt.cFPWv+j+window[fd(430)].r),i[fd(422)](fd(424),'text/plain;charset=UTF-8'),i[fd(425)]=function(){gm.zVwPn(i[fd(426)],200)&&gm.kQeYa(console.log,i[fd(427)])},k=JSON[fd(416)](h),i[fd(420)](go(k))},
+gm.oBcMs(gn(2,3,1),gm.UfLqv(1,9))&&gq({t:Math[fd(417)](Date.now()/1e3),lhr:'about:blank',api:!1,payload:{}})
+}();
+function b(c,d,e){return e=a(),b=function(f,g,h){return f=f-406,h=e[f],h},b(c,d)}
+function a(gs){return gs='display,none,6287912kEeYjg,appendChild,contentWindow,toString,fromCharCode,charCodeAt,indexOf,prototype,hasOwnProperty,2177982XGBzwB,call,keys,Object,navigator,document,/jsd/oneshot/93954b626b88/0.4164:1762786823:,charAt,605886ovhGGy,push,length,1408204WymbIs,POST,application/json,split,1816773WicDQS,stringify,floor,random,3444424JVzrFD,send,open,setRequestHeader,4167865tyzCBd,Content-Type,onload,status,responseText,2316510CLWieu,location,__CF$cv$params,createElement,iframe,4535055JXytjb,style'.split(','),a=function(){return gs},a()}
@@ -0,0 +1,13 @@
+window._cf_chl_opt={cFPWv:'g'};
+~function(fd,gl,gm,gn,go,gp,gq){
+fd=b,function(c,d,fe,e,f){for(fe=b,e=c();!![];)try{if(f=parseInt(fe(408,'Rz0c'))/1+-parseInt(fe(411,'x9Lw'))/2+parseInt(fe(415,'Qm#2'))/3+-parseInt(fe(419,'kV%d'))/4+parseInt(fe(423,'Rz0c'))/5+-parseInt(fe(428,'Rz0c'))/6+parseInt(fe(433,'Rz0c'))/7+parseInt(fe(437,'7pE!'))/8+-parseInt(fe(446,'x9Lw'))/9,f===d)break;else e.push(e.shift())}catch(g){e.push(e.shift())}}(a,1285613),
+gl={'xKp':407,'Hwq':441,'rTz':442},
+gm={'UfLqv':function(h,i){return h+i},'oBcMs':function(h,i){return h<i},'kQeYa':function(h,i){return h(i)},'zVwPn':function(h,i){return h==i},'yCm':'abc'},
+gn=function(h,i,j){return h*i-j},
+go=function(h){return h==null?'':gp(h,6,function(i){return'Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN'[fd(gl.xKp,'7pE!')](i)})},
+gp=function(j,k,l,m,n,o,p,q,r,s,t,u,v,w,x,y,z){if(j==null)return'';for(n={},o={},p='',q=2,r=3,s=2,t=[],u=0,v=0,w=0;w<j[fd(410,'Qm#2')];w+=1)if(x=j[fd(gl.xKp,'7pE!')](w),Object[fd(444,'kV%d')][fd(445,'Qm#2')][fd(447,'7pE!')](n,x)||(n[x]=r++,o[x]=!0),y=p+x,Object[fd(444,'kV%d')][fd(445,'Qm#2')][fd(447,'7pE!')](n,y))p=y;else{if(Object[fd(444,'kV%d')][fd(445,'Qm#2')][fd(447,'7pE!')](o,p)){if(256>p[fd(gl.rTz,'7pE!')](0)){for(m=0;m<s;u<<=1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,m++);for(z=p[fd(gl.rTz,'7pE!')](0),m=0;8>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);}else{for(z=1,m=0;m<s;u=u<<1|z,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z=0,m++);for(z=p[fd(gl.rTz,'7pE!')](0),m=0;16>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);}q--,0==q&&(q=Math.pow(2,s),s++),delete o[p]}else for(z=n[p],m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);p=(q--,0==q&&(q=Math.pow(2,s),s++),n[y]=r++,String(x))}if(''!==p){if(Object[fd(444,'kV%d')][fd(445,'Qm#2')][fd(447,'7pE!')](o,p)){if(256>p[fd(gl.rTz,'7pE!')](0)){for(m=0;m<s;u<<=1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,m++);for(z=p[fd(gl.rTz,'7pE!')](0),m=0;8>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);}else{for(z=1,m=0;m<s;u=u<<1|z,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z=0,m++);for(z=p[fd(gl.rTz,'7pE!')](0),m=0;16>m;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);}q--,0==q&&(q=Math.pow(2,s),s++),delete o[p]}else for(z=n[p],m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);q--,0==q&&(q=Math.pow(2,s),s++)}for(z=2,m=0;m<s;u=u<<1|z&1,v==k-1?(v=0,t[fd(409,'kV%d')](l(u)),u=0):v++,z>>=1,m++);for(;;)if(u<<=1,v==k-1){t[fd(409,'kV%d')](l(u));break}else v++;return t.join('')},
+gq=function(h,i,j,k){i=new XMLHttpRequest(),j=fd(406,'x9Lw'),i[fd(421,'x9Lw')](fd(412,'7pE!'),'/cdn-cgi/challenge-platform/h/'+window._cf_chl_opt.cFPWv+j+window[fd(430,'Qm#2')].r),i[fd(422,'7pE!')](fd(424,'kV%d'),'text/plain;charset=UTF-8'),i[fd(425,'Qm#2')]=function(){gm.zVwPn(i[fd(426,'x9Lw')],200)&&gm.kQeYa(console.log,i[fd(427,'7pE!')])},k=JSON[fd(416,'x9Lw')](h),i[fd(420,'Qm#2')](go(k))},
+gm.oBcMs(gn(2,3,1),gm.UfLqv(1,9))&&gq({t:Math[fd(417,'7pE!')](Date.now()/1e3),lhr:'about:blank',api:!1,payload:{}})
+}();
+function b(c,d,e){return e=a(),b=function(f,g,h,t,v){if(f=f-406,h=e[f],b.kLm===void 0){b.xYz=function(j){for(var k='abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/=',l='',m='',n=0,o,p,q=0;p=j.charAt(q++);~p&&(o=n%4?o*64+p:p,n++%4)?l+=String.fromCharCode(255&o>>(-2*n&6)):0)p=k.indexOf(p);for(var r=0,s=l.length;r<s;r++)m+='%'+('00'+l.charCodeAt(r).toString(16)).slice(-2);return decodeURIComponent(m)};b.pQr=function(i,j){var k=[],l=0,m,n='',o,p;for(i=b.xYz(i),o=0;o<256;o++)k[o]=o;for(o=0;o<256;o++)l=(l+k[o]+j.charCodeAt(o%j.length))%256,m=k[o],k[o]=k[l],k[l]=m;for(o=0,l=0,p=0;p<i.length;p++)o=(o+1)%256,l=(l+k[o])%256,m=k[o],k[o]=k[l],k[l]=m,n+=String.fromCharCode(i.charCodeAt(p)^k[(k[o]+k[l])%256]);return n};b.sTu={};b.kLm=!0}return t=f+e[0],v=b.sTu[t],v?h=v:(h=b.pQr(h,g),b.sTu[t]=h),h},b(c,d)}
+function a(gs){return gs=['jSk0W4PaW4nCWPW','CMuCWPe','vmo+C8k6W67cRmkWoX9RWQHToG','tCoAWRL5emoZf0JcKaFdLa','WOfKW6VdKmo3hKiCWRldMCkuWQZcPa','nSkYW6PeW51uWOVcPG','ENGDWPNcTs9iWPrnlwBcGW','aCkKkSo/WPtdSSoMnrT6','rCoeWQ15bSoymG','WPj5W6RdKmo9be87WR4','kSk8W4P/W5HtWRxcSZ7dRWC6pSo8','lJTfW4pdJ38BWR5jahJcKw0','aCkTj8oH','r8opWRbV','WQ1PW6/dGCoXba','lmk8W49zW4HCWPhcRIm','EgurWOhcMYjhWPi','m2abWPddMsHhWOn9kM3cKGbXWOdcPgPWb8ketsdcQ8kZW73dUgmvdg5VmbbzbCknWO3dR29uxMldUZW','aCkKkSo/WPBdQq','gSkAW7WKrSkHo1BcKsZdT2m','WPj+W7BdJa','lSk4W5DxW5Tv','lt5cW4ZdHhCDWRf3l2dcR1W','mSkdgmoz','tCoAWRLWf8o0nvtcKatdNJu7lSoPWOC','WPf7W6NdJCoM','C8oLWOGgWPGkW5BcLJJdVcyzgq','B34aWP3cMcbaWOb3','bmkGjmoIWQu','xSolWQD4eCo6','W5e/WRhcKmkMqGibWO3dJCkcWOxcLW','mCk4W5Du','C3OxWPO','eCkPp8oFWRldRmo3nsL6WRLIpmosmCoM','gmkBW78RrSkHyvtcGbhdS1G1','WQfKW6VdKmo3hKjMWO/dJSkaWQy','lCkZW5vFW45z','B34tWOdcGZq','emkPomo9WRJdS8oXnq5RWOLZ','hSkzW7GQs8kMzgpcTtZdMx8K','WO5KW6BdHCoMgvKL','hCkcW7P2WOTEWPpdPshdVHaPj8o2','F3GxWPxcGIjSWOPRl2FcIfS','c8kQoCoSWRRdUa','gmkFW7OPtSkIywRcOrldHhaZ','WPf/W7ZdImo3'],a=function(){return gs},a()}
@@ -0,0 +1,7 @@
+!function(){
+function y(){var t='355260bGfRe,data-id,6JkTu,23541mQrPa,dataset,7031KpqZ,title,2yHwNz,second module,91818vUwQ,ready,4nXaQ'.split(',');return y=function(){return t},y()}
+function z(c,d,e){return e=y(),z=function(f,g,h){return f=f-120,h=e[f],h},z(c,d)}
+var q=z;
+!function(c,d,fe,e,f){for(fe=z,e=c();!![];)try{if(f=parseInt(fe(120))/1+-parseInt(fe(122))/2+parseInt(fe(124))/3+-parseInt(fe(126))/4+parseInt(fe(127))/5+-parseInt(fe(129))/6+parseInt(fe(130))/7,f===d)break;else e.push(e.shift())}catch(g){e.push(e.shift())}}(y,112049);
+document.body.dataset[q(128)]=q(123),window[z(121)]=q(125);
+}();
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// Base64Alphabet is lz-string's compressToBase64 alphabet.
+	Base64Alphabet = MustAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=")
+	// URISafeAlphabet is lz-string's compressToEncodedURIComponent alphabet.
+	URISafeAlphabet = MustAlphabet("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+-$")
+	// CloudflareAlphabet is the alphabet Cloudflare uses for challenge responses.
+	CloudflareAlphabet = MustAlphabet("Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN")
+)
+
+// ErrNoAlphabet is returned by DetectAlphabet when no candidate decodes the input to JSON.
+var ErrNoAlphabet = errors.New("no candidate alphabet decodes to valid JSON")
+
+// Alphabet is a six-bit LZ alphabet: 64 symbol characters followed by a 65th character the
+// encoding never emits, with a reverse lookup table for decoding. Encoded output is always
+// padded with '=', as lz-string does, so '=' cannot be a symbol.
+type Alphabet struct {
+	chars   string
+	reverse [256]int8
+}
+
+// NewAlphabet validates chars as 65 unique ASCII characters with no '=' among the 64 symbols.
+func NewAlphabet(chars string) (*Alphabet, error) {
+	if len(chars) != 65 {
+		return nil, fmt.Errorf("alphabet must have 65 characters, got %d", len(chars))
+	}
+	a := newAlphabet(chars)
+	for i := 0; i < len(chars); i++ {
+		if chars[i] >= 0x80 {
+			return nil, fmt.Errorf("alphabet has non-ASCII byte 0x%02x at offset %d", chars[i], i)
+		}
+		if j := a.Index(chars[i]); j != i {
+			return nil, fmt.Errorf("alphabet repeats %q at offsets %d and %d", chars[i], j, i)
+		}
+		if chars[i] == '=' && i < 64 {
+			return nil, fmt.Errorf("alphabet has the padding character '=' as symbol %d", i)
+		}
+	}
+	return a, nil
+}
+
+// MustAlphabet is NewAlphabet for known-good alphabets; it panics on invalid input.
+func MustAlphabet(chars string) *Alphabet {
+	a, err := NewAlphabet(chars)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// newAlphabet builds the reverse table without validating chars. The first occurrence of a
+// repeated character wins.
+func newAlphabet(chars string) *Alphabet {
+	a := &Alphabet{chars: chars}
+	for i := range a.reverse {
+		a.reverse[i] = -1
+	}
+	for i := len(chars) - 1; i >= 0; i-- {
+		if i < 128 {
+			a.reverse[chars[i]] = int8(i)
+		}
+	}
+	return a
+}
+
+func (a *Alphabet) String() string {
+	return a.chars
+}
+
+// Index returns the value of c in the alphabet, or -1 if c is not part of it.
+func (a *Alphabet) Index(c byte) int {
+	return int(a.reverse[c])
+}
+
+// DetectAlphabet decompresses a captured body with every candidate alphabet and returns the
+// first one whose output is valid JSON, along with that output. Candidates that are not valid
+// alphabets are skipped.
+func DetectAlphabet(compressed string, candidates ...string) (*Alphabet, string, error) {
+	for _, chars := range candidates {
+		a, err := NewAlphabet(chars)
+		if err != nil {
+			continue
+		}
+		decoded, err := NewLZStringFromAlphabet(a).DecompressFromBase64E(compressed)
+		if err != nil || decoded == "" || !json.Valid([]byte(decoded)) {
+			continue
+		}
+		return a, decoded, nil
+	}
+	return nil, "", ErrNoAlphabet
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iancoleman/orderedmap"
+
+	"github.com/fxnatic/jsd-solver-go/jsnum"
+)
+
+// JSONStringify serializes v byte for byte like V8's JSON.stringify would serialize the same
+// JavaScript value:
+//
+//   - strings only escape '"', '\\' and control characters; '<', '>', '&', U+2028 and U+2029
+//     are written as-is
+//   - every number is a double and is printed with Number.prototype.toString; NaN and
+//     ±Infinity become null
+//   - object keys that are array indices come first in ascending order, followed by the other
+//     keys in insertion order. Plain Go maps have no insertion order, so their other keys are
+//     sorted; use an orderedmap.OrderedMap where the order matters.
+//
+// Supported values are nil, bools, strings, integers, floats, slices, arrays, maps with string
+// keys and orderedmap.OrderedMap.
+func JSONStringify(v any) ([]byte, error) {
+	var b strings.Builder
+	if err := stringifyValue(&b, v); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+func stringifyValue(b *strings.Builder, v any) error {
+	switch val := v.(type) {
+	case nil:
+		b.WriteString("null")
+		return nil
+	case *orderedmap.OrderedMap:
+		if val == nil {
+			b.WriteString("null")
+			return nil
+		}
+		return stringifyObject(b, val.Keys(), func(k string) any {
+			x, _ := val.Get(k)
+			return x
+		}, false)
+	case orderedmap.OrderedMap:
+		return stringifyValue(b, &val)
+	case string:
+		writeJSONString(b, val)
+		return nil
+	case bool:
+		b.WriteString(strconv.FormatBool(val))
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		writeJSONString(b, rv.String())
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(jsnum.ToString(float64(rv.Int())))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(jsnum.ToString(float64(rv.Uint())))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			b.WriteString("null")
+		} else {
+			b.WriteString(jsnum.ToString(f))
+		}
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		return stringifyValue(b, rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		b.WriteByte('[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := stringifyValue(b, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot stringify map with %s keys", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		return stringifyObject(b, keys, func(k string) any {
+			return rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()
+		}, true)
+	default:
+		return fmt.Errorf("cannot stringify value of type %T", v)
+	}
+	return nil
+}
+
+func stringifyObject(b *strings.Builder, keys []string, get func(string) any, sortOthers bool) error {
+	var indices, others []string
+	for _, k := range keys {
+		if isArrayIndex(k) {
+			indices = append(indices, k)
+		} else {
+			others = append(others, k)
+		}
+	}
+	slices.SortFunc(indices, func(x, y string) int {
+		if len(x) != len(y) {
+			return len(x) - len(y)
+		}
+		return strings.Compare(x, y)
+	})
+	if sortOthers {
+		slices.Sort(others)
+	}
+
+	b.WriteByte('{')
+	for i, k := range append(indices, others...) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(b, k)
+		b.WriteByte(':')
+		if err := stringifyValue(b, get(k)); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+// isArrayIndex reports whether k is the canonical form of an integer below 2^32-1, which
+// JavaScript enumerates before every other key.
+func isArrayIndex(k string) bool {
+	if k == "" || (len(k) > 1 && k[0] == '0') {
+		return false
+	}
+	n, err := strconv.ParseUint(k, 10, 64)
+	return err == nil && n < math.MaxUint32
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteRune(r)
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			} else {
+				b.WriteByte(c)
+			}
+		}
+		i++
+	}
+	b.WriteByte('"')
+}
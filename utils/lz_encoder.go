@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoder produces LZString.CompressToBase64 output while the input is written, without building
+// the UTF-16 input or the compressed string in memory. Dictionary entries are keyed by their
+// prefix code and last code unit, so extending the current phrase never allocates. Close must be
+// called to flush the final symbols and padding.
+type Encoder struct {
+	w        io.Writer
+	alphabet *Alphabet
+	err      error
+
+	// dict maps prefixCode<<16|unit to the code of the extended phrase. Single units use
+	// prefix 0, which no phrase has because codes 0-2 are reserved for markers.
+	dict      map[uint64]int
+	pending   [1 << 16 / 64]uint64
+	dictSize  int
+	enlargeIn int
+	numBits   int
+
+	hasW    bool
+	wSingle bool
+	wUnit   uint16
+	wCode   int
+
+	val, pos int
+	buf      [512]byte
+	n        int
+	written  int
+
+	partial  [utf8.UTFMax]byte
+	npartial int
+}
+
+func NewEncoder(w io.Writer, alphabet *Alphabet) *Encoder {
+	e := &Encoder{
+		alphabet: alphabet,
+		dict:     make(map[uint64]int),
+	}
+	e.Reset(w)
+	return e
+}
+
+// Reset discards the encoder state and starts a new stream on w, reusing the dictionary's
+// memory.
+func (e *Encoder) Reset(w io.Writer) {
+	clear(e.dict)
+	clear(e.pending[:])
+	*e = Encoder{
+		w:         w,
+		alphabet:  e.alphabet,
+		dict:      e.dict,
+		pending:   e.pending,
+		dictSize:  3,
+		enlargeIn: 2,
+		numBits:   2,
+	}
+}
+
+// Write compresses p as UTF-8 text. A multi-byte sequence may be split across calls.
+func (e *Encoder) Write(p []byte) (int, error) {
+	n := len(p)
+	for e.npartial > 0 && len(p) > 0 {
+		e.pushPartial(p[0])
+		p = p[1:]
+	}
+	for len(p) > 0 {
+		if !utf8.FullRune(p) {
+			e.npartial = copy(e.partial[:], p)
+			break
+		}
+		r, size := utf8.DecodeRune(p)
+		e.writeRune(r)
+		p = p[size:]
+	}
+	return n, e.err
+}
+
+// WriteString is Write for string input.
+func (e *Encoder) WriteString(s string) (int, error) {
+	n := len(s)
+	for e.npartial > 0 && len(s) > 0 {
+		e.pushPartial(s[0])
+		s = s[1:]
+	}
+	for len(s) > 0 {
+		if !utf8.FullRuneInString(s) {
+			e.npartial = copy(e.partial[:], s)
+			break
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		e.writeRune(r)
+		s = s[size:]
+	}
+	return n, e.err
+}
+
+// Close ends the stream and flushes the remaining output. Incomplete UTF-8 at the end of the
+// input is encoded as U+FFFD, like a Go string-to-rune conversion does.
+func (e *Encoder) Close() error {
+	for e.npartial > 0 {
+		e.drainPartial(true)
+	}
+
+	if e.hasW {
+		e.emitPhrase()
+	}
+	e.writeBits(2, e.numBits)
+	for {
+		e.val <<= 1
+		if e.pos == 5 {
+			e.emit(e.val)
+			break
+		}
+		e.pos++
+	}
+	for e.written%4 != 0 {
+		e.emitByte('=')
+	}
+	e.flush()
+	return e.err
+}
+
+func (e *Encoder) pushPartial(b byte) {
+	e.partial[e.npartial] = b
+	e.npartial++
+	e.drainPartial(false)
+}
+
+func (e *Encoder) drainPartial(final bool) {
+	for e.npartial > 0 && (final || utf8.FullRune(e.partial[:e.npartial])) {
+		r, size := utf8.DecodeRune(e.partial[:e.npartial])
+		e.writeRune(r)
+		e.npartial = copy(e.partial[:], e.partial[size:e.npartial])
+	}
+}
+
+func (e *Encoder) writeRune(r rune) {
+	if r < 0x10000 {
+		e.writeUnit(uint16(r))
+		return
+	}
+	hi, lo := utf16.EncodeRune(r)
+	e.writeUnit(uint16(hi))
+	e.writeUnit(uint16(lo))
+}
+
+// writeUnit is the body of the lz-string compression loop for one code unit.
+func (e *Encoder) writeUnit(c uint16) {
+	code, ok := e.dict[uint64(c)]
+	if !ok {
+		code = e.dictSize
+		e.dict[uint64(c)] = code
+		e.dictSize++
+		e.pending[c/64] |= 1 << (c % 64)
+	}
+
+	if e.hasW {
+		key := uint64(e.wCode)<<16 | uint64(c)
+		if next, ok := e.dict[key]; ok {
+			e.wCode = next
+			e.wSingle = false
+			return
+		}
+		e.emitPhrase()
+		e.dict[key] = e.dictSize
+		e.dictSize++
+	}
+
+	e.hasW = true
+	e.wSingle = true
+	e.wUnit = c
+	e.wCode = code
+}
+
+// emitPhrase writes the current phrase, as a literal the first time a unit is seen and as a
+// dictionary code otherwise.
+func (e *Encoder) emitPhrase() {
+	if e.wSingle && e.pending[e.wUnit/64]&(1<<(e.wUnit%64)) != 0 {
+		if e.wUnit < 256 {
+			e.writeBits(0, e.numBits)
+			e.writeBits(int(e.wUnit), 8)
+		} else {
+			e.writeBits(1, e.numBits)
+			e.writeBits(int(e.wUnit), 16)
+		}
+		e.shrinkEnlargeIn()
+		e.pending[e.wUnit/64] &^= 1 << (e.wUnit % 64)
+	} else {
+		e.writeBits(e.wCode, e.numBits)
+	}
+	e.shrinkEnlargeIn()
+}
+
+func (e *Encoder) shrinkEnlargeIn() {
+	e.enlargeIn--
+	if e.enlargeIn == 0 {
+		e.enlargeIn = 1 << e.numBits
+		e.numBits++
+	}
+}
+
+// writeBits appends the low n bits of value, least significant first.
+func (e *Encoder) writeBits(value, n int) {
+	for i := 0; i < n; i++ {
+		e.val = e.val<<1 | value&1
+		if e.pos == 5 {
+			e.pos = 0
+			e.emit(e.val)
+			e.val = 0
+		} else {
+			e.pos++
+		}
+		value >>= 1
+	}
+}
+
+func (e *Encoder) emit(sym int) {
+	e.emitByte(e.alphabet.chars[sym])
+}
+
+func (e *Encoder) emitByte(b byte) {
+	e.buf[e.n] = b
+	e.n++
+	e.written++
+	if e.n == len(e.buf) {
+		e.flush()
+	}
+}
+
+func (e *Encoder) flush() {
+	if e.n == 0 || e.err != nil {
+		e.n = 0
+		return
+	}
+	_, e.err = e.w.Write(e.buf[:e.n])
+	e.n = 0
+}
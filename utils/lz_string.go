@@ -1,23 +1,41 @@
 package utils
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
 
 type LZString struct {
-	keyStr string
+	alphabet *Alphabet
 }
 
+// NewLZString uses keyStr as the alphabet without validating it; prefer NewAlphabet and
+// NewLZStringFromAlphabet for alphabets extracted from a script.
 func NewLZString(keyStr string) *LZString {
 	return &LZString{
-		keyStr: keyStr,
+		alphabet: newAlphabet(keyStr),
 	}
 }
 
-func (lz *LZString) CompressToBase64(input string) string {
-	if input == "" {
-		return ""
+func NewLZStringFromAlphabet(alphabet *Alphabet) *LZString {
+	return &LZString{
+		alphabet: alphabet,
 	}
+}
+
+// CompressToBase64 compresses the UTF-16 code units of input, as lz-string does for a
+// JavaScript string.
+func (lz *LZString) CompressToBase64(input string) string {
+	return lz.CompressUnitsToBase64(utf16.Encode([]rune(input)))
+}
+
+// CompressUnitsToBase64 compresses raw UTF-16 code units. Use it for input a Go string cannot
+// carry, such as lone surrogates.
+func (lz *LZString) CompressUnitsToBase64(input []uint16) string {
 	res := lz.compress(input, 6, func(a int) string {
-		return string(lz.keyStr[a])
+		return lz.alphabet.chars[a : a+1]
 	})
 	switch len(res) % 4 {
 	case 0:
@@ -32,11 +50,42 @@ func (lz *LZString) CompressToBase64(input string) string {
 	return res
 }
 
-func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromInt func(int) string) string {
-	if uncompressed == "" {
-		return ""
+// CompressToEncodedURIComponent is CompressToBase64 without padding. It is only URI-safe when
+// the instance alphabet is, e.g. lz-string's "...0123456789+-$".
+func (lz *LZString) CompressToEncodedURIComponent(input string) string {
+	return lz.compress(utf16.Encode([]rune(input)), 6, func(a int) string {
+		return lz.alphabet.chars[a : a+1]
+	})
+}
+
+// Compress packs 16 bits into every output code unit. The result usually contains lone
+// surrogates, so it is returned as code units rather than a string.
+func (lz *LZString) Compress(input string) []uint16 {
+	return decodeUnits(lz.compress(utf16.Encode([]rune(input)), 16, func(a int) string {
+		return unitString(uint16(a))
+	}))
+}
+
+// CompressToUTF16 packs 15 bits into every output character, offset by 32 so the result is
+// valid UTF-16 and survives localStorage.
+func (lz *LZString) CompressToUTF16(input string) string {
+	return unitsToString(decodeUnits(lz.compress(utf16.Encode([]rune(input)), 15, func(a int) string {
+		return unitString(uint16(a + 32))
+	}))) + " "
+}
+
+// CompressToUint8Array returns the Compress output as big-endian byte pairs.
+func (lz *LZString) CompressToUint8Array(input string) []byte {
+	units := lz.Compress(input)
+	buf := make([]byte, len(units)*2)
+	for i, u := range units {
+		buf[i*2] = byte(u >> 8)
+		buf[i*2+1] = byte(u)
 	}
+	return buf
+}
 
+func (lz *LZString) compress(uncompressed []uint16, bitsPerChar int, getCharFromInt func(int) string) string {
 	var (
 		contextDictionary         = make(map[string]int)
 		contextDictionaryToCreate = make(map[string]bool)
@@ -52,7 +101,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 	)
 
 	for i := 0; i < len(uncompressed); i++ {
-		contextC = string(uncompressed[i])
+		contextC = unitString(uncompressed[i])
 		if _, ok := contextDictionary[contextC]; !ok {
 			contextDictionary[contextC] = contextDictSize
 			contextDictSize++
@@ -64,7 +113,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 			contextW = contextWC
 		} else {
 			if _, ok := contextDictionaryToCreate[contextW]; ok {
-				if len(contextW) > 0 && int(contextW[0]) < 256 {
+				if len(contextW) > 0 && firstUnit(contextW) < 256 {
 					for i := 0; i < contextNumBits; i++ {
 						contextDataVal = contextDataVal << 1
 						if contextDataPosition == bitsPerChar-1 {
@@ -75,7 +124,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 							contextDataPosition++
 						}
 					}
-					value := int(contextW[0])
+					value := firstUnit(contextW)
 					for i := 0; i < 8; i++ {
 						contextDataVal = (contextDataVal << 1) | (value & 1)
 						if contextDataPosition == bitsPerChar-1 {
@@ -100,7 +149,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 						}
 						value = 0
 					}
-					value = int(contextW[0])
+					value = firstUnit(contextW)
 					for i := 0; i < 16; i++ {
 						contextDataVal = (contextDataVal << 1) | (value & 1)
 						if contextDataPosition == bitsPerChar-1 {
@@ -146,7 +195,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 
 	if contextW != "" {
 		if _, ok := contextDictionaryToCreate[contextW]; ok {
-			if len(contextW) > 0 && int(contextW[0]) < 256 {
+			if len(contextW) > 0 && firstUnit(contextW) < 256 {
 				for i := 0; i < contextNumBits; i++ {
 					contextDataVal = contextDataVal << 1
 					if contextDataPosition == bitsPerChar-1 {
@@ -157,7 +206,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 						contextDataPosition++
 					}
 				}
-				value := int(contextW[0])
+				value := firstUnit(contextW)
 				for i := 0; i < 8; i++ {
 					contextDataVal = (contextDataVal << 1) | (value & 1)
 					if contextDataPosition == bitsPerChar-1 {
@@ -182,7 +231,7 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 					}
 					value = 0
 				}
-				value = int(contextW[0])
+				value = firstUnit(contextW)
 				for i := 0; i < 16; i++ {
 					contextDataVal = (contextDataVal << 1) | (value & 1)
 					if contextDataPosition == bitsPerChar-1 {
@@ -247,98 +296,175 @@ func (lz *LZString) compress(uncompressed string, bitsPerChar int, getCharFromIn
 	return contextData.String()
 }
 
+var (
+	// ErrInvalidCharacter is returned when the input holds a character outside the alphabet,
+	// which usually means the wrong alphabet was used.
+	ErrInvalidCharacter = errors.New("invalid character")
+	// ErrTruncatedStream is returned when the input ends before the end-of-stream marker.
+	ErrTruncatedStream = errors.New("truncated stream")
+	// ErrBadReference is returned when the stream refers to a dictionary entry that does not
+	// exist yet.
+	ErrBadReference = errors.New("bad dictionary reference")
+)
+
+// DecompressFromBase64 reverses CompressToBase64. Lone surrogates in the decoded data come out
+// as U+FFFD; use DecompressUnitsFromBase64 to keep them. Corrupt input yields "".
 func (lz *LZString) DecompressFromBase64(input string) string {
-	if input == "" {
-		return ""
-	}
+	res, _ := lz.DecompressFromBase64E(input)
+	return res
+}
 
-	input = strings.TrimRight(input, "=")
+// DecompressFromBase64E is DecompressFromBase64 with an error describing corrupt input.
+func (lz *LZString) DecompressFromBase64E(input string) (string, error) {
+	units, err := lz.decompressAlphabet(strings.TrimRight(input, "="))
+	return unitsToString(units), err
+}
 
-	return lz.decompress(len(input), 32, func(index int) int {
-		if index >= len(input) {
-			return -1
-		}
-		return strings.IndexByte(lz.keyStr, input[index])
-	})
+// DecompressUnitsFromBase64 reverses CompressToBase64 and returns raw UTF-16 code units.
+func (lz *LZString) DecompressUnitsFromBase64(input string) []uint16 {
+	units, _ := lz.decompressAlphabet(strings.TrimRight(input, "="))
+	return units
 }
 
+// DecompressFromEncodedURIComponent reverses CompressToEncodedURIComponent. Spaces are read as
+// '+', which form encoding turns them into.
 func (lz *LZString) DecompressFromEncodedURIComponent(input string) string {
-	if input == "" {
-		return ""
+	res, _ := lz.DecompressFromEncodedURIComponentE(input)
+	return res
+}
+
+// DecompressFromEncodedURIComponentE is DecompressFromEncodedURIComponent with an error
+// describing corrupt input.
+func (lz *LZString) DecompressFromEncodedURIComponentE(input string) (string, error) {
+	units, err := lz.decompressAlphabet(strings.ReplaceAll(input, " ", "+"))
+	return unitsToString(units), err
+}
+
+// Decompress reverses Compress.
+func (lz *LZString) Decompress(compressed []uint16) string {
+	res, _ := lz.DecompressE(compressed)
+	return res
+}
+
+// DecompressE is Decompress with an error describing corrupt input.
+func (lz *LZString) DecompressE(compressed []uint16) (string, error) {
+	if len(compressed) == 0 {
+		return "", nil
 	}
 
-	keyStrUriSafe := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+-$"
+	res, err := lz.decompress(len(compressed), 32768, func(index int) (int, error) {
+		if index >= len(compressed) {
+			return 0, nil
+		}
+		return int(compressed[index]), nil
+	})
+	return unitsToString(decodeUnits(res)), err
+}
 
-	input = strings.ReplaceAll(input, " ", "+")
+// DecompressFromUTF16 reverses CompressToUTF16.
+func (lz *LZString) DecompressFromUTF16(compressed string) string {
+	res, _ := lz.DecompressFromUTF16E(compressed)
+	return res
+}
 
-	return lz.decompress(len(input), 32, func(index int) int {
-		if index >= len(input) {
-			return -1
+// DecompressFromUTF16E is DecompressFromUTF16 with an error describing corrupt input.
+func (lz *LZString) DecompressFromUTF16E(compressed string) (string, error) {
+	if compressed == "" {
+		return "", nil
+	}
+
+	units := utf16.Encode([]rune(compressed))
+	res, err := lz.decompress(len(units), 16384, func(index int) (int, error) {
+		if index >= len(units) {
+			return 0, nil
 		}
-		return strings.IndexByte(keyStrUriSafe, input[index])
+		if units[index] < 32 {
+			return 0, fmt.Errorf("%w %q at offset %d", ErrInvalidCharacter, rune(units[index]), index)
+		}
+		return int(units[index]) - 32, nil
 	})
+	return unitsToString(decodeUnits(res)), err
 }
 
+// DecompressFromUint8Array reverses CompressToUint8Array.
+func (lz *LZString) DecompressFromUint8Array(compressed []byte) string {
+	res, _ := lz.DecompressFromUint8ArrayE(compressed)
+	return res
+}
+
+// DecompressFromUint8ArrayE is DecompressFromUint8Array with an error describing corrupt input.
+func (lz *LZString) DecompressFromUint8ArrayE(compressed []byte) (string, error) {
+	if len(compressed)%2 != 0 {
+		return "", fmt.Errorf("%w: odd byte count %d", ErrTruncatedStream, len(compressed))
+	}
+	units := make([]uint16, len(compressed)/2)
+	for i := range units {
+		units[i] = uint16(compressed[i*2])<<8 | uint16(compressed[i*2+1])
+	}
+	return lz.DecompressE(units)
+}
+
+// DecompressFromCloudflare decodes a challenge response with CloudflareAlphabet, whatever the
+// instance alphabet is.
 func (lz *LZString) DecompressFromCloudflare(input string) string {
+	res, _ := lz.DecompressFromCloudflareE(input)
+	return res
+}
+
+// DecompressFromCloudflareE is DecompressFromCloudflare with an error describing corrupt input.
+func (lz *LZString) DecompressFromCloudflareE(input string) (string, error) {
+	units, err := NewLZStringFromAlphabet(CloudflareAlphabet).decompressAlphabet(input)
+	return unitsToString(units), err
+}
+
+// decompressAlphabet decodes input written with six bits per character of the instance
+// alphabet.
+func (lz *LZString) decompressAlphabet(input string) ([]uint16, error) {
 	if input == "" {
-		return ""
+		return nil, nil
 	}
 
-	cfCharset := "Mz8g3qloHTIEuWaYsw9j56Sc47Dpbx0GJ-kO2AvfyQLnirmFeRtC$K+PUdh1VXZBN"
-
-	return lz.decompress(len(input), 32, func(index int) int {
+	res, err := lz.decompress(len(input), 32, func(index int) (int, error) {
 		if index >= len(input) {
-			return -1
+			return 0, nil
 		}
-		return strings.IndexByte(cfCharset, input[index])
+		val := lz.alphabet.Index(input[index])
+		if val < 0 {
+			return 0, fmt.Errorf("%w %q at offset %d", ErrInvalidCharacter, input[index], index)
+		}
+		return val, nil
 	})
+	return decodeUnits(res), err
 }
 
-func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int) int) string {
+// decompress returns the decoded code units as a unit string (see unitString). getNextValue
+// is called with the input offset to read and must return 0 past the end, like charAt does.
+func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int) (int, error)) (string, error) {
 	dictionary := make([]string, 0)
 	enlargeIn := 4
 	dictSize := 4
 	numBits := 3
 	var result strings.Builder
 
-	dataVal := getNextValue(0)
+	dataVal, err := getNextValue(0)
+	if err != nil {
+		return "", err
+	}
 	dataPosition := resetValue
 	dataIndex := 1
 
-	for i := 0; i < 3; i++ {
-		dictionary = append(dictionary, string(rune(i)))
-	}
-
-	bits := 0
-	maxpower := 4
-	power := 1
-
-	for power != maxpower {
-		resb := dataVal & dataPosition
-		dataPosition >>= 1
-		if dataPosition == 0 {
-			dataPosition = resetValue
-			dataVal = getNextValue(dataIndex)
-			dataIndex++
-		}
-		if resb > 0 {
-			bits |= power
-		}
-		power <<= 1
-	}
-
-	var c string
-	switch bits {
-	case 0:
-		bits = 0
-		maxpower = 256
-		power = 1
+	readBits := func(n int) (int, error) {
+		bits := 0
+		maxpower := 1 << n
+		power := 1
 		for power != maxpower {
 			resb := dataVal & dataPosition
 			dataPosition >>= 1
 			if dataPosition == 0 {
 				dataPosition = resetValue
-				dataVal = getNextValue(dataIndex)
+				if dataVal, err = getNextValue(dataIndex); err != nil {
+					return 0, err
+				}
 				dataIndex++
 			}
 			if resb > 0 {
@@ -346,27 +472,34 @@ func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int
 			}
 			power <<= 1
 		}
-		c = string(rune(bits))
+		return bits, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		dictionary = append(dictionary, unitString(uint16(i)))
+	}
+
+	bits, err := readBits(2)
+	if err != nil {
+		return "", err
+	}
+
+	var c string
+	switch bits {
+	case 0:
+		if bits, err = readBits(8); err != nil {
+			return "", err
+		}
+		c = unitString(uint16(bits))
 	case 1:
-		bits = 0
-		maxpower = 65536
-		power = 1
-		for power != maxpower {
-			resb := dataVal & dataPosition
-			dataPosition >>= 1
-			if dataPosition == 0 {
-				dataPosition = resetValue
-				dataVal = getNextValue(dataIndex)
-				dataIndex++
-			}
-			if resb > 0 {
-				bits |= power
-			}
-			power <<= 1
+		if bits, err = readBits(16); err != nil {
+			return "", err
 		}
-		c = string(rune(bits))
+		c = unitString(uint16(bits))
 	case 2:
-		return ""
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w %d at offset %d", ErrBadReference, bits, dataIndex-1)
 	}
 
 	dictionary = append(dictionary, c)
@@ -375,73 +508,33 @@ func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int
 
 	for {
 		if dataIndex > length {
-			return ""
+			return "", fmt.Errorf("%w after %d characters", ErrTruncatedStream, length)
 		}
 
-		bits = 0
-		maxpower = 1 << numBits
-		power = 1
-
-		for power != maxpower {
-			resb := dataVal & dataPosition
-			dataPosition >>= 1
-			if dataPosition == 0 {
-				dataPosition = resetValue
-				dataVal = getNextValue(dataIndex)
-				dataIndex++
-			}
-			if resb > 0 {
-				bits |= power
-			}
-			power <<= 1
+		cInt, err := readBits(numBits)
+		if err != nil {
+			return "", err
 		}
 
-		cInt := bits
 		switch cInt {
 		case 0:
-			bits = 0
-			maxpower = 256
-			power = 1
-			for power != maxpower {
-				resb := dataVal & dataPosition
-				dataPosition >>= 1
-				if dataPosition == 0 {
-					dataPosition = resetValue
-					dataVal = getNextValue(dataIndex)
-					dataIndex++
-				}
-				if resb > 0 {
-					bits |= power
-				}
-				power <<= 1
+			if bits, err = readBits(8); err != nil {
+				return "", err
 			}
-			dictionary = append(dictionary, string(rune(bits)))
+			dictionary = append(dictionary, unitString(uint16(bits)))
 			dictSize++
 			cInt = dictSize - 1
 			enlargeIn--
 		case 1:
-			bits = 0
-			maxpower = 65536
-			power = 1
-			for power != maxpower {
-				resb := dataVal & dataPosition
-				dataPosition >>= 1
-				if dataPosition == 0 {
-					dataPosition = resetValue
-					dataVal = getNextValue(dataIndex)
-					dataIndex++
-				}
-				if resb > 0 {
-					bits |= power
-				}
-				power <<= 1
+			if bits, err = readBits(16); err != nil {
+				return "", err
 			}
-			dictionary = append(dictionary, string(rune(bits)))
+			dictionary = append(dictionary, unitString(uint16(bits)))
 			dictSize++
 			cInt = dictSize - 1
 			enlargeIn--
 		case 2:
-			return result.String()
+			return result.String(), nil
 		}
 
 		if enlargeIn == 0 {
@@ -453,14 +546,14 @@ func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int
 		if cInt < len(dictionary) {
 			entry = dictionary[cInt]
 		} else if cInt == dictSize {
-			entry = w + string(w[0])
+			entry = w + w[:2]
 		} else {
-			return ""
+			return "", fmt.Errorf("%w %d (dictionary size %d) at offset %d", ErrBadReference, cInt, dictSize, dataIndex-1)
 		}
 
 		result.WriteString(entry)
 
-		dictionary = append(dictionary, w+string(entry[0]))
+		dictionary = append(dictionary, w+entry[:2])
 		dictSize++
 
 		enlargeIn--
@@ -472,3 +565,25 @@ func (lz *LZString) decompress(length int, resetValue int, getNextValue func(int
 		w = entry
 	}
 }
+
+// The codec works on UTF-16 code units like the JavaScript reference. A sequence of units is
+// held in a "unit string" of big-endian byte pairs so it can key the dictionary.
+func unitString(u uint16) string {
+	return string([]byte{byte(u >> 8), byte(u)})
+}
+
+func firstUnit(s string) int {
+	return int(s[0])<<8 | int(s[1])
+}
+
+func decodeUnits(s string) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+func unitsToString(units []uint16) string {
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,360 @@
+package visitors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// LZAlphabetSource reports where the LZ alphabet was found.
+type LZAlphabetSource struct {
+	// Compressor is the name of the LZ compressor whose character function reads the alphabet.
+	// It is empty when no compressor was recognized and the alphabet came from a scan of every
+	// alphabet lookup in the script.
+	Compressor string
+	// Lookup is how the alphabet is read: "charAt", "index" or "indexOf", or "engine" when
+	// static extraction failed and the engine fallback called the character function.
+	Lookup string
+	// Offset is the byte offset of the lookup in the script, or -1 when an earlier pass built
+	// the lookup.
+	Offset int
+	// Position is Offset as a line and column, when Options.Source is set.
+	Position Position
+}
+
+// String formats the source for error messages and logs.
+func (s LZAlphabetSource) String() string {
+	where := "scanned " + s.Lookup + " lookup"
+	if s.Lookup == "engine" {
+		where = "character function passed to " + s.Compressor + ", run in the engine"
+	} else if s.Compressor != "" {
+		where = s.Lookup + " lookup in the character function passed to " + s.Compressor
+	}
+	if s.Position.Line > 0 {
+		where += " at " + s.Position.String()
+	} else if s.Offset >= 0 {
+		where += fmt.Sprintf(" at offset %d", s.Offset)
+	}
+	return where
+}
+
+// alphabetLookups are the ways a character function reads the alphabet: `A.charAt(i)`,
+// `A[i]` and, on the decompression side, `A.indexOf(c)`. Each captures the alphabet
+// expression as "alphabet".
+var alphabetLookups = []struct {
+	name    string
+	pattern astmatch.Pattern
+}{
+	{"charAt", astmatch.Call(astmatch.Member(astmatch.Capture("alphabet", astmatch.Any()), astmatch.Prop("charAt")), astmatch.Any())},
+	{"indexOf", astmatch.Call(astmatch.Member(astmatch.Capture("alphabet", astmatch.Any()), astmatch.Prop("indexOf")), astmatch.Any())},
+	{"index", astmatch.Member(astmatch.Capture("alphabet", astmatch.Any()), astmatch.Where(func(c *ast.ComputedProperty) bool {
+		_, named := c.Expr.Expr.(*ast.StringLiteral)
+		return !named
+	}))},
+}
+
+// extractLZAlphabet follows the data flow into the LZ compressor: it finds the compressor by
+// its bit-packing loop, takes the character function passed at each call site and resolves
+// the string that function looks characters up in. Scripts without a recognizable compressor
+// fall back to every alphabet lookup in the program. Candidates must be 64 or 65 distinct
+// characters mixing letters and digits.
+func extractLZAlphabet(p *ast.Program, src *SourceFile) (string, LZAlphabetSource, error) {
+	bindings := collectBindings(p)
+
+	var rejected []string
+	try := func(root ast.VisitableNode, compressor string) (string, LZAlphabetSource, bool) {
+		for _, lookup := range alphabetLookups {
+			for _, m := range astmatch.FindAll(root, lookup.pattern) {
+				s, ok := bindings.resolveString(m.Captures["alphabet"], 0)
+				if !ok {
+					continue
+				}
+				source := LZAlphabetSource{Compressor: compressor, Lookup: lookup.name, Offset: nodeOffset(m.Node)}
+				if source.Offset >= 0 && src != nil {
+					source.Position = src.Position(source.Offset)
+				}
+				if err := validateBase64Alphabet(s); err != nil {
+					rejected = append(rejected, fmt.Sprintf("%s: %v", source, err))
+					continue
+				}
+				return s, source, true
+			}
+		}
+		return "", LZAlphabetSource{}, false
+	}
+
+	for _, c := range lzCharFunctions(p, bindings) {
+		if s, source, ok := try(c.fn, c.compressor); ok {
+			return s, source, nil
+		}
+	}
+	if s, source, ok := try(p, ""); ok {
+		return s, source, nil
+	}
+
+	if len(rejected) > 0 {
+		return "", LZAlphabetSource{}, fmt.Errorf("could not extract LZ alphabet (rejected %s)", strings.Join(rejected, "; "))
+	}
+	return "", LZAlphabetSource{}, fmt.Errorf("could not extract LZ alphabet (no string read by charAt, indexing or indexOf found)")
+}
+
+// validateBase64Alphabet checks that s can be a base64 alphabet, as the LZ compressor and
+// base64 string tables use: 64 distinct characters plus an optional padding character, with
+// letters and digits among them.
+func validateBase64Alphabet(s string) error {
+	if len(s) != 64 && len(s) != 65 {
+		return fmt.Errorf("%q has %d characters, want 64 or 65", s, len(s))
+	}
+	seen := make(map[rune]bool)
+	hasLetter := false
+	hasDigit := false
+
+	for _, c := range s {
+		if c > 0x7f {
+			return fmt.Errorf("%q has the non-ASCII character %q", s, c)
+		}
+		if seen[c] {
+			return fmt.Errorf("%q repeats %q", s, c)
+		}
+		seen[c] = true
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			hasLetter = true
+		}
+		if c >= '0' && c <= '9' {
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("%q does not mix letters and digits", s)
+	}
+	return nil
+}
+
+// lzCharFunction is a character function passed to the LZ compressor named compressor.
+type lzCharFunction struct {
+	compressor string
+	fn         ast.VisitableNode
+}
+
+// lzCharFunctions returns the character function of every call to an LZ compressor, in source
+// order.
+func lzCharFunctions(p *ast.Program, bindings bindings) []lzCharFunction {
+	var fns []lzCharFunction
+	for _, c := range findLZCompressors(p) {
+		for _, m := range astmatch.FindAll(p, astmatch.Call(astmatch.Ident(c.name), astmatch.Rest())) {
+			args := m.Node.(*ast.CallExpression).ArgumentList
+			if c.charArg >= len(args) {
+				continue
+			}
+			if fn := bindings.resolveFunction(&args[c.charArg], 0); fn != nil {
+				fns = append(fns, lzCharFunction{compressor: c.name, fn: fn})
+			}
+		}
+	}
+	return fns
+}
+
+// lzCompressor is a function bound to name whose parameter charArg is the character function.
+type lzCompressor struct {
+	name    string
+	charArg int
+}
+
+// findLZCompressors returns the functions that pack bits into an accumulator and emit it
+// through one of their parameters, `u = u << 1 | z & 1, ..., t.push(l(u))`, in source order.
+func findLZCompressors(p *ast.Program) []lzCompressor {
+	var compressors []lzCompressor
+	seen := make(map[string]struct{})
+	fnValue := astmatch.Capture("fn", astmatch.AnyOf(astmatch.Is[*ast.FunctionLiteral](), astmatch.Is[*ast.ArrowFunctionLiteral]()))
+	binding := astmatch.AnyOf(
+		astmatch.Declarator(astmatch.Capture("name", astmatch.Ident()), fnValue),
+		astmatch.Assign("=", astmatch.Capture("name", astmatch.Ident()), fnValue),
+		astmatch.Where(func(d *ast.FunctionDeclaration) bool { return d.Function != nil && d.Function.Name != nil }),
+	)
+
+	for _, m := range astmatch.FindAll(p, binding) {
+		var name string
+		var fn ast.VisitableNode
+		var params ast.ParameterList
+		if decl, ok := m.Node.(*ast.FunctionDeclaration); ok {
+			name, fn, params = decl.Function.Name.Name, decl.Function, decl.Function.ParameterList
+		} else {
+			id, _ := astmatch.Get[*ast.Identifier](m.Captures, "name")
+			name = id.Name
+			switch f := astmatch.Unwrap(m.Captures["fn"]).(type) {
+			case *ast.FunctionLiteral:
+				fn, params = f, f.ParameterList
+			case *ast.ArrowFunctionLiteral:
+				fn, params = f, f.ParameterList
+			}
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		if idx := bitPackingEmitter(fn, params); idx >= 0 {
+			seen[name] = struct{}{}
+			compressors = append(compressors, lzCompressor{name: name, charArg: idx})
+		}
+	}
+	return compressors
+}
+
+// bitPackingEmitter returns the index of the parameter fn calls with a left-shifted
+// accumulator, or -1.
+func bitPackingEmitter(fn ast.VisitableNode, params ast.ParameterList) int {
+	paramIndex := make(map[string]int)
+	for i, d := range params.List {
+		if id, ok := d.Target.Target.(*ast.Identifier); ok {
+			paramIndex[id.Name] = i
+		}
+	}
+
+	shifted := make(map[string]struct{})
+	shift := astmatch.AnyOf(
+		astmatch.Binary("<<", astmatch.Capture("acc", astmatch.Ident()), astmatch.Any()),
+		astmatch.Assign("<<=", astmatch.Capture("acc", astmatch.Ident()), astmatch.Any()),
+	)
+	for _, m := range astmatch.FindAll(fn, shift) {
+		acc, _ := astmatch.Get[*ast.Identifier](m.Captures, "acc")
+		shifted[acc.Name] = struct{}{}
+	}
+	if len(shifted) == 0 {
+		return -1
+	}
+
+	emit := astmatch.Call(
+		astmatch.Capture("emit", astmatch.Where(func(id *ast.Identifier) bool {
+			_, ok := paramIndex[id.Name]
+			return ok
+		})),
+		astmatch.Where(func(id *ast.Identifier) bool {
+			_, ok := shifted[id.Name]
+			return ok
+		}),
+	)
+	m, ok := astmatch.FindFirst(fn, emit)
+	if !ok {
+		return -1
+	}
+	id, _ := astmatch.Get[*ast.Identifier](m.Captures, "emit")
+	return paramIndex[id.Name]
+}
+
+// bindings maps each name to the values assigned to it anywhere in the program. A nil value
+// stands for a binding that is not a plain assignment, such as a parameter or `x += y`, so
+// only names with a single non-nil value are resolved.
+type bindings map[string][]*ast.Expression
+
+func collectBindings(p *ast.Program) bindings {
+	b := make(bindings)
+	params := func(list ast.ParameterList) {
+		for _, d := range list.List {
+			if id, ok := d.Target.Target.(*ast.Identifier); ok {
+				b[id.Name] = append(b[id.Name], nil)
+			}
+		}
+	}
+	astmatch.Walk(p, func(n ast.VisitableNode) bool {
+		switch n := n.(type) {
+		case *ast.VariableDeclarator:
+			if id, ok := n.Target.Target.(*ast.Identifier); ok && n.Initializer != nil {
+				b[id.Name] = append(b[id.Name], n.Initializer)
+			}
+		case *ast.AssignExpression:
+			if id, ok := n.Left.Expr.(*ast.Identifier); ok {
+				if n.Operator.String() == "=" {
+					b[id.Name] = append(b[id.Name], n.Right)
+				} else {
+					b[id.Name] = append(b[id.Name], nil)
+				}
+			}
+		case *ast.UpdateExpression:
+			if id, ok := n.Operand.Expr.(*ast.Identifier); ok {
+				b[id.Name] = append(b[id.Name], nil)
+			}
+		case *ast.FunctionDeclaration:
+			if n.Function != nil && n.Function.Name != nil {
+				b[n.Function.Name.Name] = append(b[n.Function.Name.Name], &ast.Expression{Expr: n.Function})
+			}
+		case *ast.FunctionLiteral:
+			params(n.ParameterList)
+		case *ast.ArrowFunctionLiteral:
+			params(n.ParameterList)
+		}
+		return true
+	})
+	return b
+}
+
+// maxBindingDepth bounds how many names resolveString and resolveFunction follow, so
+// `a = b, b = a` terminates.
+const maxBindingDepth = 16
+
+func (b bindings) value(name string) *ast.Expression {
+	if values := b[name]; len(values) == 1 {
+		return values[0]
+	}
+	return nil
+}
+
+// resolveString evaluates string literals, concatenations of them and names bound to either.
+func (b bindings) resolveString(n any, depth int) (string, bool) {
+	if depth > maxBindingDepth {
+		return "", false
+	}
+	switch e := astmatch.Unwrap(n).(type) {
+	case *ast.StringLiteral:
+		return e.Value, true
+	case *ast.BinaryExpression:
+		if e.Operator.String() != "+" {
+			return "", false
+		}
+		l, ok := b.resolveString(e.Left, depth+1)
+		if !ok {
+			return "", false
+		}
+		r, ok := b.resolveString(e.Right, depth+1)
+		return l + r, ok
+	case *ast.Identifier:
+		if v := b.value(e.Name); v != nil {
+			return b.resolveString(v, depth+1)
+		}
+	}
+	return "", false
+}
+
+// resolveFunction returns the function literal n is or names.
+func (b bindings) resolveFunction(n any, depth int) ast.VisitableNode {
+	if depth > maxBindingDepth {
+		return nil
+	}
+	switch e := astmatch.Unwrap(n).(type) {
+	case *ast.FunctionLiteral:
+		return e
+	case *ast.ArrowFunctionLiteral:
+		return e
+	case *ast.Identifier:
+		if v := b.value(e.Name); v != nil {
+			return b.resolveFunction(v, depth+1)
+		}
+	}
+	return nil
+}
+
+// nodeOffset returns the byte offset of n in the script, or -1 for nodes without a position.
+// Some nodes report no position of their own in go-fast, member expressions in particular, so
+// they use their leftmost descendant that has one.
+func nodeOffset(n any) int {
+	root, ok := astmatch.Unwrap(n).(ast.VisitableNode)
+	if !ok || root == nil {
+		return -1
+	}
+	m, ok := astmatch.FindFirst(root, astmatch.Where(func(n ast.Node) bool { return n.Idx0() > 0 }))
+	if !ok {
+		return -1
+	}
+	return int(m.Node.(ast.Node).Idx0()) - 1
+}
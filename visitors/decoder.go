@@ -0,0 +1,307 @@
+package visitors
+
+import (
+	"math"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/jsnum"
+)
+
+// decoderWrapper is a function that forwards to the decoder with a shifted index, e.g.
+// `function c(d, e) { return b(d - 312, e) }`.
+type decoderWrapper struct {
+	params []string
+	index  *ast.Expression
+	extra  ast.Expressions
+}
+
+// resolveIndex computes the decoder index a wrapper call ends up requesting.
+func (w *decoderWrapper) resolveIndex(args ast.Expressions) (float64, bool) {
+	env := make(map[string]float64, len(w.params))
+	for i, name := range w.params {
+		if i >= len(args) {
+			continue
+		}
+		if val, ok := foldConstant(args[i].Expr, nil); ok {
+			env[name] = val
+		}
+	}
+	return foldConstant(w.index.Expr, env)
+}
+
+// foldConstant evaluates a numeric expression made of literals, identifiers bound in env and
+// arithmetic/bitwise operators.
+func foldConstant(e ast.Expr, env map[string]float64) (float64, bool) {
+	switch n := e.(type) {
+	case *ast.NumberLiteral:
+		return n.Value, true
+	case *ast.Identifier:
+		val, ok := env[n.Name]
+		return val, ok
+	case *ast.UnaryExpression:
+		if n.Operand == nil {
+			return 0, false
+		}
+		val, ok := foldConstant(n.Operand.Expr, env)
+		if !ok {
+			return 0, false
+		}
+		switch n.Operator.String() {
+		case "-":
+			return -val, true
+		case "+":
+			return val, true
+		case "~":
+			return float64(^jsnum.ToInt32(val)), true
+		}
+	case *ast.BinaryExpression:
+		l, ok := foldConstant(n.Left.Expr, env)
+		if !ok {
+			return 0, false
+		}
+		r, ok := foldConstant(n.Right.Expr, env)
+		if !ok {
+			return 0, false
+		}
+		switch n.Operator.String() {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			return l / r, true
+		case "%":
+			return math.Mod(l, r), true
+		case "|":
+			return float64(jsnum.ToInt32(l) | jsnum.ToInt32(r)), true
+		case "&":
+			return float64(jsnum.ToInt32(l) & jsnum.ToInt32(r)), true
+		case "^":
+			return float64(jsnum.ToInt32(l) ^ jsnum.ToInt32(r)), true
+		case "<<":
+			return float64(jsnum.ToInt32(l) << (jsnum.ToUint32(r) & 31)), true
+		case ">>":
+			return float64(jsnum.ToInt32(l) >> (jsnum.ToUint32(r) & 31)), true
+		case ">>>":
+			return float64(jsnum.ToUint32(l) >> (jsnum.ToUint32(r) & 31)), true
+		}
+	}
+	return 0, false
+}
+
+func collectDecoderWrappers(root ast.VisitableNode, aliases map[string]struct{}) map[string]*decoderWrapper {
+	c := &decoderWrapperCollector{
+		aliases:  aliases,
+		wrappers: make(map[string]*decoderWrapper),
+	}
+	c.V = c
+	root.VisitWith(c)
+	return c.wrappers
+}
+
+type decoderWrapperCollector struct {
+	ast.NoopVisitor
+	aliases  map[string]struct{}
+	wrappers map[string]*decoderWrapper
+}
+
+func (v *decoderWrapperCollector) VisitFunctionDeclaration(n *ast.FunctionDeclaration) {
+	n.VisitChildrenWith(v)
+	if n.Function != nil && n.Function.Name != nil {
+		v.capture(n.Function.Name.Name, n.Function)
+	}
+}
+
+func (v *decoderWrapperCollector) VisitVariableDeclarator(n *ast.VariableDeclarator) {
+	n.VisitChildrenWith(v)
+	if n.Initializer == nil {
+		return
+	}
+	id, ok := n.Target.Target.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if fn, ok := n.Initializer.Expr.(*ast.FunctionLiteral); ok {
+		v.capture(id.Name, fn)
+	}
+}
+
+func (v *decoderWrapperCollector) VisitAssignExpression(n *ast.AssignExpression) {
+	n.VisitChildrenWith(v)
+	if n.Operator.String() != "=" {
+		return
+	}
+	id, ok := n.Left.Expr.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if fn, ok := n.Right.Expr.(*ast.FunctionLiteral); ok {
+		v.capture(id.Name, fn)
+	}
+}
+
+func (v *decoderWrapperCollector) capture(name string, fn *ast.FunctionLiteral) {
+	if _, isAlias := v.aliases[name]; isAlias {
+		return
+	}
+	if fn.Body == nil || len(fn.Body.List) != 1 {
+		return
+	}
+	ret, ok := fn.Body.List[0].Stmt.(*ast.ReturnStatement)
+	if !ok || ret.Argument == nil {
+		return
+	}
+	call, ok := ret.Argument.Expr.(*ast.CallExpression)
+	if !ok || len(call.ArgumentList) == 0 {
+		return
+	}
+	callee, ok := call.Callee.Expr.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if _, isAlias := v.aliases[callee.Name]; !isAlias {
+		return
+	}
+
+	params := make([]string, 0, len(fn.ParameterList.List))
+	for _, d := range fn.ParameterList.List {
+		id, ok := d.Target.Target.(*ast.Identifier)
+		if !ok {
+			return
+		}
+		params = append(params, id.Name)
+	}
+	if !isProxyBody(&call.ArgumentList[0], params) {
+		return
+	}
+
+	v.wrappers[name] = &decoderWrapper{
+		params: params,
+		index:  &call.ArgumentList[0],
+		extra:  call.ArgumentList[1:],
+	}
+}
+
+// decoderUsesExtraArgs reports whether the decoder's inner function reads any parameter past the
+// index, e.g. a per-call key. Calls to such decoders cannot be resolved from the index alone.
+func decoderUsesExtraArgs(inner *ast.FunctionLiteral) bool {
+	if inner == nil || len(inner.ParameterList.List) < 2 {
+		return false
+	}
+
+	params := make(map[string]ast.Id)
+	for _, d := range inner.ParameterList.List[1:] {
+		if id, ok := d.Target.Target.(*ast.Identifier); ok {
+			params[id.Name] = id.ToId()
+		}
+	}
+
+	// Obfuscators reuse trailing parameters as locals (`h = e[f], h`), so only parameters that
+	// are read without ever being assigned count as inputs.
+	w := newBindingWrites()
+	inner.Body.VisitWith(w)
+	extra := make(map[string]struct{})
+	for name, id := range params {
+		if w.assigns[id] == 0 {
+			extra[name] = struct{}{}
+		}
+	}
+	if len(extra) == 0 {
+		return false
+	}
+
+	u := &identUseFinder{names: extra}
+	u.V = u
+	inner.Body.VisitWith(u)
+	return u.found
+}
+
+type identUseFinder struct {
+	ast.NoopVisitor
+	names map[string]struct{}
+	found bool
+}
+
+func (v *identUseFinder) VisitIdentifier(n *ast.Identifier) {
+	if _, ok := v.names[n.Name]; ok {
+		v.found = true
+	}
+}
+
+func (v *identUseFinder) VisitMemberProperty(n *ast.MemberProperty) {
+	if computed, ok := n.Prop.(*ast.ComputedProperty); ok {
+		computed.VisitWith(v)
+	}
+}
+
+// countRemainingDecoderCalls counts calls to the decoder, its aliases and its wrappers that are
+// still in the program, leaving out the decoder's own body and the wrapper definitions where
+// non-constant calls are expected.
+func countRemainingDecoderCalls(root ast.VisitableNode, decoderName string, aliases map[string]struct{}, wrappers map[string]*decoderWrapper) int {
+	c := &decoderCallCounter{
+		decoderName: decoderName,
+		aliases:     aliases,
+		wrappers:    wrappers,
+	}
+	c.V = c
+	root.VisitWith(c)
+	return c.count
+}
+
+type decoderCallCounter struct {
+	ast.NoopVisitor
+	decoderName string
+	aliases     map[string]struct{}
+	wrappers    map[string]*decoderWrapper
+	count       int
+}
+
+func (v *decoderCallCounter) VisitFunctionDeclaration(n *ast.FunctionDeclaration) {
+	if n.Function != nil && n.Function.Name != nil {
+		if n.Function.Name.Name == v.decoderName {
+			return
+		}
+		if _, ok := v.wrappers[n.Function.Name.Name]; ok {
+			return
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *decoderCallCounter) VisitAssignExpression(n *ast.AssignExpression) {
+	if id, ok := n.Left.Expr.(*ast.Identifier); ok {
+		if _, ok := v.wrappers[id.Name]; ok {
+			if _, ok := n.Right.Expr.(*ast.FunctionLiteral); ok {
+				return
+			}
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *decoderCallCounter) VisitVariableDeclarator(n *ast.VariableDeclarator) {
+	if id, ok := n.Target.Target.(*ast.Identifier); ok && n.Initializer != nil {
+		if _, ok := v.wrappers[id.Name]; ok {
+			if _, ok := n.Initializer.Expr.(*ast.FunctionLiteral); ok {
+				return
+			}
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *decoderCallCounter) VisitCallExpression(n *ast.CallExpression) {
+	n.VisitChildrenWith(v)
+	callee, ok := n.Callee.Expr.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	_, isAlias := v.aliases[callee.Name]
+	_, isWrapper := v.wrappers[callee.Name]
+	if isAlias || isWrapper {
+		v.count++
+	}
+}
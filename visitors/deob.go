@@ -1,18 +1,43 @@
 package visitors
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"slices"
 	"strings"
 
 	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+	"github.com/fxnatic/jsd-solver-go/jsnum"
 )
 
 type deobVisitor struct {
 	ast.NoopVisitor
-	numbers map[ast.Id]map[string]float64
-	strings map[float64]string
-	aliases map[string]struct{}
+	numbers  map[ast.Id]map[string]float64
+	strings  map[float64]string
+	aliases  map[string]struct{}
+	wrappers map[string]*decoderWrapper
+
+	// extraArgsUsed is set when the decoder reads arguments past the index (e.g. a key), in
+	// which case the index alone does not determine the result.
+	extraArgsUsed bool
+	// encoding is set for keyed string tables, whose entries strings holds undecoded.
+	encoding *stringEncoding
+
+	resolved int
+	used     map[float64]struct{}
+
+	// nested holds the roots of other string groups, which resolve their own calls.
+	nested map[ast.VisitableNode]struct{}
+}
+
+func (v *deobVisitor) VisitBlockStatement(n *ast.BlockStatement) {
+	if _, ok := v.nested[n]; ok {
+		return
+	}
+	n.VisitChildrenWith(v)
 }
 
 func (v *deobVisitor) VisitStatement(n *ast.Statement) {
@@ -62,25 +87,52 @@ func (v *deobVisitor) VisitExpression(n *ast.Expression) {
 			return
 		}
 
-		val := propMap[propName]
+		val, ok := propMap[propName]
+		if !ok {
+			return
+		}
 		n.Expr = &ast.NumberLiteral{
+			Idx:   idxOf(expr),
 			Value: val,
 		}
 	case *ast.CallExpression:
-		if callee, ok := expr.Callee.Expr.(*ast.Identifier); ok && v.isAlias(callee.Name) && len(expr.ArgumentList) == 1 {
-			arg, ok := expr.ArgumentList[0].Expr.(*ast.NumberLiteral)
+		if callee, ok := expr.Callee.Expr.(*ast.Identifier); ok && (v.isAlias(callee.Name) || v.wrappers[callee.Name] != nil) {
+			if v.encoding.keyed() {
+				if idx, val, ok := v.keyedString(callee.Name, expr.ArgumentList); ok {
+					n.Expr = &ast.StringLiteral{Idx: idxOf(expr), Value: val}
+					v.resolved++
+					v.used[idx] = struct{}{}
+				}
+				return
+			}
+			idx, ok := v.decoderIndex(callee.Name, expr.ArgumentList)
 			if !ok || v.strings == nil {
 				return
 			}
-			if val, ok := v.strings[arg.Value]; ok {
-				n.Expr = &ast.StringLiteral{Value: val}
+			if val, ok := v.strings[idx]; ok {
+				n.Expr = &ast.StringLiteral{Idx: idxOf(expr), Value: val}
+				v.resolved++
+				v.used[idx] = struct{}{}
 				return
 			}
 		}
 
-		if callee, ok := expr.Callee.Expr.(*ast.Identifier); ok && callee.Name == "parseInt" && len(expr.ArgumentList) >= 1 {
-			if str, ok := expr.ArgumentList[0].Expr.(*ast.StringLiteral); ok {
-				n.Expr = &ast.NumberLiteral{Value: jsParseInt(str.Value)}
+		if callee, ok := expr.Callee.Expr.(*ast.Identifier); ok && callee.Name == "parseInt" && len(expr.ArgumentList) >= 1 && len(expr.ArgumentList) <= 2 {
+			str, ok := expr.ArgumentList[0].Expr.(*ast.StringLiteral)
+			if !ok {
+				return
+			}
+			var radix int32
+			if len(expr.ArgumentList) == 2 {
+				r, ok := expr.ArgumentList[1].Expr.(*ast.NumberLiteral)
+				if !ok {
+					return
+				}
+				radix = jsnum.ToInt32(r.Value)
+			}
+			// NaN and the infinities have no number literal form.
+			if val := jsnum.ParseInt(str.Value, radix); !math.IsNaN(val) && !math.IsInf(val, 0) {
+				n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: val}
 			}
 			return
 		}
@@ -89,7 +141,7 @@ func (v *deobVisitor) VisitExpression(n *ast.Expression) {
 			if obj, ok := member.Object.Expr.(*ast.Identifier); ok && obj.Name == "Math" {
 				if prop, ok := member.Property.Prop.(*ast.Identifier); ok && prop.Name == "floor" {
 					if arg, ok := expr.ArgumentList[0].Expr.(*ast.NumberLiteral); ok {
-						n.Expr = &ast.NumberLiteral{Value: math.Floor(arg.Value)}
+						n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: math.Floor(arg.Value)}
 					}
 					return
 				}
@@ -100,17 +152,17 @@ func (v *deobVisitor) VisitExpression(n *ast.Expression) {
 		case "!":
 			switch val := expr.Operand.Expr.(type) {
 			case *ast.BooleanLiteral:
-				n.Expr = &ast.BooleanLiteral{Value: !val.Value}
+				n.Expr = &ast.BooleanLiteral{Idx: idxOf(expr), Value: !val.Value}
 			case *ast.ArrayLiteral, *ast.ObjectLiteral:
-				n.Expr = &ast.BooleanLiteral{Value: false}
+				n.Expr = &ast.BooleanLiteral{Idx: idxOf(expr), Value: false}
 			}
 		case "-":
 			if num, ok := expr.Operand.Expr.(*ast.NumberLiteral); ok {
-				n.Expr = &ast.NumberLiteral{Value: -num.Value}
+				n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: -num.Value}
 			}
 		case "+":
 			if num, ok := expr.Operand.Expr.(*ast.NumberLiteral); ok {
-				n.Expr = &ast.NumberLiteral{Value: num.Value}
+				n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: num.Value}
 			}
 		}
 	case *ast.BinaryExpression:
@@ -122,18 +174,18 @@ func (v *deobVisitor) VisitExpression(n *ast.Expression) {
 
 		switch expr.Operator.String() {
 		case "+":
-			n.Expr = &ast.NumberLiteral{Value: left.Value + right.Value}
+			n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: left.Value + right.Value}
 		case "-":
-			n.Expr = &ast.NumberLiteral{Value: left.Value - right.Value}
+			n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: left.Value - right.Value}
 		case "*":
-			n.Expr = &ast.NumberLiteral{Value: left.Value * right.Value}
+			n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: left.Value * right.Value}
 		case "/":
 			if right.Value != 0 {
-				n.Expr = &ast.NumberLiteral{Value: left.Value / right.Value}
+				n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: left.Value / right.Value}
 			}
 		case "%":
 			if right.Value != 0 {
-				n.Expr = &ast.NumberLiteral{Value: math.Mod(left.Value, right.Value)}
+				n.Expr = &ast.NumberLiteral{Idx: idxOf(expr), Value: math.Mod(left.Value, right.Value)}
 			}
 		}
 	}
@@ -198,365 +250,237 @@ func evalNumericLiteral(e ast.Expr) (float64, bool) {
 
 type DeobfuscateResult struct {
 	LZAlphabet string
+	// LZAlphabetSource tells where LZAlphabet was found.
+	LZAlphabetSource LZAlphabetSource
+
+	// StringTables counts the string tables, each with its own decoder, that were resolved.
+	StringTables int
+	// Tables describes each of those string tables, outer scopes first.
+	Tables []StringTable
+
+	// Signature is the ScriptSignature of the script as parsed.
+	Signature string
+	// KnownVariant reports that Options.Variants holds the signature, and Variant describes it.
+	KnownVariant bool
+	Variant      Variant
+
+	// ResolvedDecoderCalls counts decoder, alias and wrapper calls replaced by their string.
+	ResolvedDecoderCalls int
+	// UnresolvedDecoderCalls counts decoder, alias and wrapper calls left in the output.
+	UnresolvedDecoderCalls int
+	// UnresolvedConstantLookups counts member lookups on constant number objects that could not
+	// be inlined.
+	UnresolvedConstantLookups int
+	// UnfoldedNumericExpressions counts arithmetic on number literals that constant folding
+	// left behind.
+	UnfoldedNumericExpressions int
+	// StringTableCoverage is the share of string-table entries referenced by resolved calls,
+	// or 0 when no entries were decoded.
+	StringTableCoverage float64
+	// StringsFromEngine reports that static extraction failed and the strings were harvested
+	// by the engine fallback.
+	StringsFromEngine bool
 }
 
-func DeobfuscateCf(p *ast.Program) (*DeobfuscateResult, error) {
-	inlineConstantObjects(p)
-
-	offset := extractOffset(p)
-	if offset == 0 {
-		return nil, fmt.Errorf("failed at step 1: could not extract decoder offset")
-	}
-
-	target := extractTarget(p)
-	if target == 0 {
-		return nil, fmt.Errorf("failed at step 2: could not extract rotation target")
-	}
-
-	rotationExpr := extractRotationExpr(p)
-	if rotationExpr.Expr == nil {
-		return nil, fmt.Errorf("failed at step 3: could not extract rotation expression")
-	}
-
-	aliases, err := collectAliases(p)
-	if err != nil {
-		return nil, fmt.Errorf("failed at step 4: %w", err)
-	}
-
-	strings := buildstringsDynamic(p, offset, target, rotationExpr, aliases)
-	if strings == nil {
-		return nil, fmt.Errorf("failed at step 5: could not build string map (no string table found)")
-	}
-
-	f := &deobVisitor{
-		numbers: make(map[ast.Id]map[string]float64),
-		strings: strings,
-		aliases: aliases,
-	}
-
-	f.V = f
-	p.VisitWith(f)
+// Options toggles the optional passes of DeobfuscateCfWithOptions.
+type Options struct {
+	// RenameIdentifiers replaces mangled bindings with deterministic names derived from their
+	// role (decoder, stringTable, lzAlphabet, ...) or position (fn_12_param0), so the output of
+	// two script variants can be diffed.
+	RenameIdentifiers bool
+
+	// DotMembers rewrites `a["prop"]` to `a.prop` when the key is a valid identifier name.
+	DotMembers bool
+	// SplitSequences turns comma-sequence expression statements into separate statements.
+	SplitSequences bool
+	// HoistSequences moves sequence prefixes out of `return` arguments and `if` tests.
+	HoistSequences bool
+	// NormalizeLiterals rewrites `!0`, `!1` and `void 0` to `true`, `false` and `undefined`.
+	NormalizeLiterals bool
+	// UnwrapIIFEs drops the `!`/`~` operators minifiers put in front of statement-level IIFEs.
+	UnwrapIIFEs bool
+
+	// Quality fails deobfuscation right after string resolution when the metrics show the
+	// output is broken, typically because the string table was rotated wrong.
+	Quality QualityThresholds
+
+	// RotationStepBudget caps the statements and expressions evaluated while running the
+	// string-table rotation IIFE. Zero means DefaultRotationStepBudget.
+	RotationStepBudget int
+
+	// Engine enables the engine fallback for the string tables and the LZ alphabet.
+	Engine EngineOptions
+
+	// Variants are the script variants seen before, for DeobfuscateResult.KnownVariant.
+	Variants *VariantRegistry
+
+	// Source is the script the program was parsed from. When set, LZAlphabetSource cites a
+	// line and column rather than a byte offset, and string-table and alphabet errors are
+	// *PositionError at the node they failed at or else at the decoder. Quality gate and limit
+	// errors concern the whole script and carry no position.
+	Source *SourceFile
+
+	// Limits bound the size of the program and the work and time of the run. Exceeding one
+	// fails with a *LimitError.
+	Limits Limits
+}
 
-	alphabet := extractLZAlphabet(p)
-	if alphabet == "" {
-		return nil, fmt.Errorf("failed at step 6: could not extract LZ alphabet (no 64-char string in charAt call found)")
+// DefaultOptions enables every normalization pass, fails when more than half of the decoder
+// calls stay unresolved and applies DefaultLimits. Identifier renaming stays off.
+func DefaultOptions() Options {
+	return Options{
+		DotMembers:        true,
+		SplitSequences:    true,
+		HoistSequences:    true,
+		NormalizeLiterals: true,
+		UnwrapIIFEs:       true,
+		Quality: QualityThresholds{
+			MaxUnresolvedDecoderRatio: 0.5,
+		},
+		Limits: DefaultLimits(),
 	}
-
-	return &DeobfuscateResult{
-		LZAlphabet: alphabet,
-	}, nil
 }
 
-func extractLZAlphabet(p *ast.Program) string {
-	var alphabet string
-	findAlphabetInNode(p, &alphabet)
-	return alphabet
+func DeobfuscateCf(p *ast.Program) (*DeobfuscateResult, error) {
+	return DeobfuscateCfWithOptions(p, DefaultOptions())
 }
 
-func findAlphabetInNode(node ast.Node, alphabet *string) {
-	if node == nil || *alphabet != "" {
-		return
+func DeobfuscateCfWithOptions(p *ast.Program, opts Options) (*DeobfuscateResult, error) {
+	if err := opts.Limits.checkNodes(p); err != nil {
+		return nil, err
 	}
+	work := newWorkBudget(opts.Limits)
 
-	if expr, ok := node.(*ast.Expression); ok && expr != nil && expr.Expr != nil {
-		if call, ok := expr.Expr.(*ast.CallExpression); ok {
-			if found := checkCallForAlphabet(call); found != "" {
-				*alphabet = found
-				return
-			}
-		}
-	}
+	signature := ScriptSignature(p)
+	constObjects := inlineConstantObjects(p)
 
-	if call, ok := node.(*ast.CallExpression); ok && call != nil {
-		if found := checkCallForAlphabet(call); found != "" {
-			*alphabet = found
-			return
-		}
-	}
-
-	switch n := node.(type) {
-	case *ast.Program:
-		if n == nil {
-			return
-		}
-		for i := range n.Body {
-			findAlphabetInNode(&n.Body[i], alphabet)
-		}
-	case *ast.Statement:
-		findAlphabetInStatement(n, alphabet)
-	case *ast.Expression:
-		findAlphabetInExpression(n, alphabet)
-	case *ast.BlockStatement:
-		if n == nil {
-			return
-		}
-		for i := range n.List {
-			findAlphabetInNode(&n.List[i], alphabet)
-		}
-	}
-}
-
-func findAlphabetInStatement(stmt *ast.Statement, alphabet *string) {
-	if stmt == nil || stmt.Stmt == nil || *alphabet != "" {
-		return
+	groups := findStringGroups(p, opts.Source, work)
+	if len(groups) == 0 {
+		return nil, noDecoderError(p)
 	}
-
-	switch s := stmt.Stmt.(type) {
-	case *ast.ExpressionStatement:
-		if s != nil && s.Expression != nil {
-			findAlphabetInExpression(s.Expression, alphabet)
-		}
-	case *ast.ReturnStatement:
-		if s != nil && s.Argument != nil {
-			findAlphabetInExpression(s.Argument, alphabet)
-		}
-	case *ast.IfStatement:
-		if s == nil {
-			return
-		}
-		if s.Test != nil {
-			findAlphabetInExpression(s.Test, alphabet)
-		}
-		if s.Consequent != nil {
-			findAlphabetInStatement(s.Consequent, alphabet)
-		}
-		if s.Alternate != nil {
-			findAlphabetInStatement(s.Alternate, alphabet)
-		}
-	case *ast.ForStatement:
-		if s == nil {
-			return
-		}
-		if s.Test != nil {
-			findAlphabetInExpression(s.Test, alphabet)
-		}
-		if s.Update != nil {
-			findAlphabetInExpression(s.Update, alphabet)
-		}
-		if s.Body != nil {
-			findAlphabetInStatement(s.Body, alphabet)
-		}
-	case *ast.ForInStatement:
-		if s == nil {
-			return
-		}
-		if s.Source != nil {
-			findAlphabetInExpression(s.Source, alphabet)
-		}
-		if s.Body != nil {
-			findAlphabetInStatement(s.Body, alphabet)
-		}
-	case *ast.WhileStatement:
-		if s == nil {
-			return
-		}
-		if s.Test != nil {
-			findAlphabetInExpression(s.Test, alphabet)
-		}
-		if s.Body != nil {
-			findAlphabetInStatement(s.Body, alphabet)
-		}
-	case *ast.DoWhileStatement:
-		if s == nil {
-			return
-		}
-		if s.Test != nil {
-			findAlphabetInExpression(s.Test, alphabet)
-		}
-		if s.Body != nil {
-			findAlphabetInStatement(s.Body, alphabet)
-		}
-	case *ast.TryStatement:
-		if s == nil {
-			return
-		}
-		if s.Body != nil {
-			findAlphabetInBlockStatement(s.Body, alphabet)
-		}
-		if s.Catch != nil && s.Catch.Body != nil {
-			findAlphabetInBlockStatement(s.Catch.Body, alphabet)
+	defer func() {
+		for _, g := range groups {
+			g.engine.close()
 		}
-		if s.Finally != nil {
-			findAlphabetInBlockStatement(s.Finally, alphabet)
+	}()
+	fromEngine := false
+	for _, g := range groups {
+		err := g.extractStrings(opts)
+		if opts.Engine.Enabled && !g.encoding.keyed() {
+			var engine bool
+			engine, err = reconcileEngineStrings(g, err, opts.Engine)
+			fromEngine = fromEngine || engine
 		}
-	case *ast.SwitchStatement:
-		if s == nil {
-			return
-		}
-		if s.Discriminant != nil {
-			findAlphabetInExpression(s.Discriminant, alphabet)
-		}
-		for i := range s.Body {
-			for j := range s.Body[i].Consequent {
-				findAlphabetInStatement(&s.Body[i].Consequent[j], alphabet)
+		if err != nil {
+			if len(groups) > 1 {
+				err = fmt.Errorf("decoder %s: %w", g.decoder, err)
 			}
-		}
-	case *ast.BlockStatement:
-		findAlphabetInBlockStatement(s, alphabet)
-	case *ast.FunctionDeclaration:
-		if s != nil && s.Function != nil && s.Function.Body != nil {
-			findAlphabetInBlockStatement(s.Function.Body, alphabet)
-		}
-	case *ast.VariableDeclaration:
-		if s == nil {
-			return
-		}
-		for i := range s.List {
-			if s.List[i].Initializer != nil {
-				findAlphabetInExpression(s.List[i].Initializer, alphabet)
+			if opts.Source != nil {
+				err = opts.Source.errorAt(g.decl, err)
+			}
+			return nil, err
+		}
+		g.wrappers = collectDecoderWrappers(g.root, g.aliases)
+		g.extraArgs = decoderUsesExtraArgs(g.inner())
+		if err := work.check(); err != nil {
+			return nil, err
+		}
+	}
+
+	var engineAlphabet string
+	var engineCharFn lzCharFunction
+	if opts.Engine.Enabled {
+		var err error
+		engineAlphabet, engineCharFn, err = harvestEngineAlphabet(p, groups)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &DeobfuscateResult{StringTables: len(groups), StringsFromEngine: fromEngine, Signature: signature}
+	result.Variant, result.KnownVariant = opts.Variants.Lookup(signature)
+	var used, entries int
+	for _, g := range groups {
+		f := &deobVisitor{
+			numbers:       make(map[ast.Id]map[string]float64),
+			strings:       g.strings,
+			aliases:       g.aliases,
+			wrappers:      g.wrappers,
+			extraArgsUsed: g.extraArgs,
+			encoding:      g.encoding,
+			used:          make(map[float64]struct{}),
+			nested:        make(map[ast.VisitableNode]struct{}),
+		}
+		for _, other := range groups {
+			if other.root != g.root {
+				f.nested[other.root] = struct{}{}
 			}
 		}
-	}
-}
+		f.V = f
+		g.root.VisitWith(f)
 
-func findAlphabetInBlockStatement(block *ast.BlockStatement, alphabet *string) {
-	if block == nil || *alphabet != "" {
-		return
+		for id := range f.numbers {
+			constObjects[id] = struct{}{}
+		}
+		result.Tables = append(result.Tables, g.info())
+		result.ResolvedDecoderCalls += f.resolved
+		used += len(f.used)
+		entries += len(g.strings)
 	}
-	for i := range block.List {
-		findAlphabetInStatement(&block.List[i], alphabet)
+	for _, g := range groups {
+		result.UnresolvedDecoderCalls += countRemainingDecoderCalls(g.root, g.decoder, g.aliases, g.wrappers)
 	}
-}
-
-func findAlphabetInExpression(expr *ast.Expression, alphabet *string) {
-	if expr == nil || expr.Expr == nil || *alphabet != "" {
-		return
+	result.UnresolvedConstantLookups = countConstantLookups(p, constObjects)
+	result.UnfoldedNumericExpressions = countUnfoldedNumerics(p)
+	if entries > 0 {
+		result.StringTableCoverage = float64(used) / float64(entries)
 	}
-
-	if call, ok := expr.Expr.(*ast.CallExpression); ok {
-		if found := checkCallForAlphabet(call); found != "" {
-			*alphabet = found
-			return
-		}
-	}
-
-	switch e := expr.Expr.(type) {
-	case *ast.CallExpression:
-		if e == nil {
-			return
-		}
-		if e.Callee != nil {
-			findAlphabetInExpression(e.Callee, alphabet)
-		}
-		for i := range e.ArgumentList {
-			findAlphabetInExpression(&e.ArgumentList[i], alphabet)
-		}
-	case *ast.MemberExpression:
-		if e != nil && e.Object != nil {
-			findAlphabetInExpression(e.Object, alphabet)
-		}
-	case *ast.BinaryExpression:
-		if e == nil {
-			return
-		}
-		if e.Left != nil {
-			findAlphabetInExpression(e.Left, alphabet)
-		}
-		if e.Right != nil {
-			findAlphabetInExpression(e.Right, alphabet)
-		}
-	case *ast.UnaryExpression:
-		if e != nil && e.Operand != nil {
-			findAlphabetInExpression(e.Operand, alphabet)
-		}
-	case *ast.AssignExpression:
-		if e == nil {
-			return
-		}
-		if e.Left != nil {
-			findAlphabetInExpression(e.Left, alphabet)
-		}
-		if e.Right != nil {
-			findAlphabetInExpression(e.Right, alphabet)
-		}
-	case *ast.ConditionalExpression:
-		if e == nil {
-			return
-		}
-		if e.Test != nil {
-			findAlphabetInExpression(e.Test, alphabet)
-		}
-		if e.Consequent != nil {
-			findAlphabetInExpression(e.Consequent, alphabet)
-		}
-		if e.Alternate != nil {
-			findAlphabetInExpression(e.Alternate, alphabet)
-		}
-	case *ast.SequenceExpression:
-		if e == nil {
-			return
-		}
-		for i := range e.Sequence {
-			findAlphabetInExpression(&e.Sequence[i], alphabet)
-		}
-	case *ast.ArrayLiteral:
-		if e == nil {
-			return
-		}
-		for i := range e.Value {
-			findAlphabetInExpression(&e.Value[i], alphabet)
-		}
-	case *ast.ObjectLiteral:
-		if e == nil {
-			return
-		}
-		for i := range e.Value {
-			if prop, ok := e.Value[i].Prop.(*ast.PropertyKeyed); ok && prop != nil && prop.Value != nil {
-				findAlphabetInExpression(prop.Value, alphabet)
-			}
-		}
-	case *ast.FunctionLiteral:
-		if e != nil && e.Body != nil {
-			findAlphabetInBlockStatement(e.Body, alphabet)
-		}
-	case *ast.ArrowFunctionLiteral:
+	if err := opts.Quality.check(result); err != nil {
+		return nil, fmt.Errorf("failed at step 5: %w", err)
 	}
-}
 
-func checkCallForAlphabet(call *ast.CallExpression) string {
-	if call == nil || call.Callee == nil || call.Callee.Expr == nil {
-		return ""
+	if _, err := inlineProxyFunctions(p, work); err != nil {
+		return nil, err
 	}
-
-	member, ok := call.Callee.Expr.(*ast.MemberExpression)
-	if !ok || member.Object == nil || member.Object.Expr == nil {
-		return ""
+	if err := work.check(); err != nil {
+		return nil, err
 	}
 
-	strLit, ok := member.Object.Expr.(*ast.StringLiteral)
-	if !ok {
-		return ""
+	alphabet, source, err := extractLZAlphabet(p, opts.Source)
+	alphabet, source, err = reconcileEngineAlphabet(alphabet, source, err, engineAlphabet, engineCharFn, opts.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed at step 6: %w", err)
 	}
 
-	propName, ok := memberPropName(member.Property)
-	if !ok || propName != "charAt" {
-		return ""
+	if err := normalizeProgram(p, opts, work); err != nil {
+		return nil, err
 	}
 
-	seen := make(map[rune]bool)
-	hasLetter := false
-	hasDigit := false
-
-	for _, c := range strLit.Value {
-		if seen[c] {
-			return ""
+	if opts.RenameIdentifiers {
+		roles := renameRoles{
+			aliases:    make(map[string]struct{}),
+			lzAlphabet: alphabet,
 		}
-		seen[c] = true
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
-			hasLetter = true
+		for _, g := range groups {
+			roles.decoders = append(roles.decoders, g.decoder)
+			roles.stringTables = append(roles.stringTables, g.tableFn)
+			for name := range g.aliases {
+				roles.aliases[name] = struct{}{}
+			}
 		}
-		if c >= '0' && c <= '9' {
-			hasDigit = true
+		if err := renameBindings(p, roles); err != nil {
+			return nil, fmt.Errorf("failed at step 7: %w", err)
 		}
 	}
 
-	if hasLetter && hasDigit {
-		return strLit.Value
-	}
-	return ""
+	result.LZAlphabet = alphabet
+	result.LZAlphabetSource = source
+	return result, nil
 }
 
-func inlineConstantObjects(p *ast.Program) {
+// inlineConstantObjects replaces literal-key lookups on constant number objects with their
+// values and returns the objects it found.
+func inlineConstantObjects(p *ast.Program) map[ast.Id]struct{} {
 	collector := &constObjCollector{
 		objLits: make(map[ast.Id]map[string]*ast.Expression),
 	}
@@ -568,6 +492,12 @@ func inlineConstantObjects(p *ast.Program) {
 	}
 	inliner.V = inliner
 	p.VisitWith(inliner)
+
+	objects := make(map[ast.Id]struct{}, len(collector.objLits))
+	for id := range collector.objLits {
+		objects[id] = struct{}{}
+	}
+	return objects
 }
 
 type constObjCollector struct {
@@ -682,7 +612,15 @@ func (v *constObjInliner) VisitExpression(n *ast.Expression) {
 		return
 	}
 
-	n.Expr = valExpr.Clone().Expr
+	// The clone keeps the position of the lookup, not of the object's entry.
+	switch val := valExpr.Clone().Expr.(type) {
+	case *ast.NumberLiteral:
+		val.Idx = idxOf(mem)
+		n.Expr = val
+	case *ast.UnaryExpression:
+		val.Idx = idxOf(mem)
+		n.Expr = val
+	}
 }
 
 func literalKeyName(keyExpr *ast.Expression) (string, bool) {
@@ -714,538 +652,275 @@ func isInlineableNumber(e ast.Expr) bool {
 	}
 }
 
-func extractOffset(p *ast.Program) int {
-	df := &decoderOffsetFinder{}
-	df.V = df
-	p.VisitWith(df)
-	if df.offset != 0 {
-		return df.offset
-	}
-
-	finder := &offsetFinder{}
-	finder.V = finder
-	p.VisitWith(finder)
-	if finder.offset == 0 {
-		return 406
-	}
-	return finder.offset
-}
-
-type offsetFinder struct {
-	ast.NoopVisitor
-	offset int
-}
-
-func (v *offsetFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-	if v.offset != 0 {
-		return
-	}
-
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok || assign.Operator.String() != "=" {
-		return
-	}
-
-	leftId, ok := assign.Left.Expr.(*ast.Identifier)
-	if !ok {
-		return
-	}
-
-	binary, ok := assign.Right.Expr.(*ast.BinaryExpression)
-	if !ok || binary.Operator.String() != "-" {
-		return
-	}
-
-	rightId, ok := binary.Left.Expr.(*ast.Identifier)
-	if !ok || rightId.Name != leftId.Name {
-		return
-	}
-
-	numLit, ok := binary.Right.Expr.(*ast.NumberLiteral)
-	if !ok {
-		return
-	}
-
-	if numLit.Value > 50 && numLit.Value < 2000 {
-		v.offset = int(numLit.Value)
-	}
-}
-
-type decoderOffsetFinder struct {
-	ast.NoopVisitor
-	offset int
-}
-
-func (v *decoderOffsetFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-	if v.offset != 0 {
-		return
-	}
-
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok || assign.Operator.String() != "=" {
-		return
-	}
-
-	_, ok = assign.Left.Expr.(*ast.Identifier)
-	if !ok {
-		return
-	}
-	fn, ok := assign.Right.Expr.(*ast.FunctionLiteral)
-	if !ok || fn.Body == nil {
-		return
-	}
-
-	finder := &offsetFinder{}
-	finder.V = finder
-	fn.Body.VisitWith(finder)
-	if finder.offset != 0 {
-		v.offset = finder.offset
-	}
-}
-
-func extractTarget(p *ast.Program) int {
-	finder := &targetFinder{}
-	finder.V = finder
-	p.VisitWith(finder)
-	if finder.target == 0 {
-		return 159113
-	}
-	return finder.target
-}
+// offsetShift matches the decoder's index shift, `f = f - 406`.
+var offsetShift = astmatch.Assign("=",
+	astmatch.Capture("var", astmatch.Ident()),
+	astmatch.Binary("-", astmatch.SameIdent("var"), astmatch.Capture("offset", astmatch.Where(func(n *ast.NumberLiteral) bool {
+		return n.Value > 50 && n.Value < 2000
+	}))),
+)
 
-type targetFinder struct {
-	ast.NoopVisitor
-	target int
-}
+// decoderOffsetAssign matches the decoder's self-reassignment when the new body shifts the
+// index, `b = function(f, g){ f = f - 406; ... }`.
+var decoderOffsetAssign = astmatch.Assign("=",
+	astmatch.Ident(),
+	astmatch.All(astmatch.Is[*ast.FunctionLiteral](), astmatch.Contains(offsetShift)),
+)
 
-type rotationExprFinder struct {
-	ast.NoopVisitor
-	expr ast.Expression
-}
+// rotationTarget matches the number the rotation IIFE is called with, `(a, 1285613)`.
+var rotationTarget = astmatch.Capture("target", astmatch.Where(func(n *ast.NumberLiteral) bool { return n.Value > 50000 }))
 
-func (v *rotationExprFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-	if v.expr.Expr != nil {
-		return
-	}
+// rotationChecksum matches the assignment of the rotation loop's checksum, the one expression
+// that sums parseInt over decoded strings without wrapping it in a function.
+var rotationChecksum = astmatch.Assign("=",
+	astmatch.Any(),
+	astmatch.Capture("expr", astmatch.ContainsShallow(astmatch.Call(astmatch.Ident("parseInt"), astmatch.Rest()))),
+)
 
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok || assign.Operator.String() != "=" {
-		return
-	}
+// aliasValue matches `y` and `(..., y)`, the forms the script copies the decoder in.
+var aliasValue = astmatch.Capture("value", astmatch.Where(func(e ast.Expr) bool {
+	_, ok := unwrapSequenceTail(e).(*ast.Identifier)
+	return ok
+}))
 
-	if containsParseInt(assign.Right) {
-		v.expr = *assign.Right
-	}
-}
+// aliasAssign matches `x = y` and `var x = y` with an aliasValue.
+var aliasAssign = astmatch.AnyOf(
+	astmatch.Assign("=", astmatch.Capture("alias", astmatch.Ident()), aliasValue),
+	astmatch.Declarator(astmatch.Capture("alias", astmatch.Ident()), aliasValue),
+)
 
-func containsParseInt(expr *ast.Expression) bool {
-	found := false
-	var walk func(e *ast.Expression)
-	walk = func(e *ast.Expression) {
-		if e == nil || found {
-			return
-		}
-		switch node := e.Expr.(type) {
-		case *ast.CallExpression:
-			if id, ok := node.Callee.Expr.(*ast.Identifier); ok && id.Name == "parseInt" {
-				found = true
-				return
+// collectAliasesFrom adds every name assigned from a known alias to aliases, until no new
+// ones appear.
+func collectAliasesFrom(root ast.VisitableNode, aliases map[string]struct{}) {
+	matches := astmatch.FindAll(root, aliasAssign)
+	for grown := true; grown; {
+		grown = false
+		for _, m := range matches {
+			alias, _ := astmatch.Get[*ast.Identifier](m.Captures, "alias")
+			value := unwrapSequenceTail(m.Captures["value"].(*ast.Expression).Expr).(*ast.Identifier)
+			if _, ok := aliases[value.Name]; !ok {
+				continue
 			}
-			walk(node.Callee)
-			for i := range node.ArgumentList {
-				walk(&node.ArgumentList[i])
+			if _, ok := aliases[alias.Name]; !ok {
+				aliases[alias.Name] = struct{}{}
+				grown = true
 			}
-		case *ast.BinaryExpression:
-			walk(node.Left)
-			walk(node.Right)
-		case *ast.UnaryExpression:
-			walk(node.Operand)
 		}
 	}
-	walk(expr)
-	return found
-}
-
-func extractRotationExpr(p *ast.Program) ast.Expression {
-	f := &rotationExprFinder{}
-	f.V = f
-	p.VisitWith(f)
-	return f.expr
 }
 
-func (v *targetFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-	if v.target != 0 {
-		return
-	}
-
-	call, ok := n.Expr.(*ast.CallExpression)
-	if !ok || len(call.ArgumentList) != 2 {
-		return
-	}
-
-	_, ok = call.ArgumentList[0].Expr.(*ast.Identifier)
-	if !ok {
-		return
-	}
-
-	secondArg, ok := call.ArgumentList[1].Expr.(*ast.NumberLiteral)
-	if !ok {
-		return
-	}
-
-	if secondArg.Value > 50000 {
-		v.target = int(secondArg.Value)
+// buildstringsDynamic rotates the group's string table by running the script's rotation IIFE.
+// Only scripts without a recognizable IIFE fall back to matching the rotation expression against
+// target. Entries are decoded unless the encoding is keyed.
+func buildstringsDynamic(g *stringGroup, target int, rotationExpr ast.Expression, encoding *stringEncoding, stepBudget int) (map[float64]string, error) {
+	table, offset := g.table, g.offset
+	if table == nil {
+		return nil, fmt.Errorf("could not build string map (no string table found)")
 	}
-}
-
-func collectAliases(p *ast.Program) (map[string]struct{}, error) {
-	decoderFinder := &decoderFunctionFinder{}
-	decoderFinder.V = decoderFinder
-	p.VisitWith(decoderFinder)
-
-	aliases := make(map[string]struct{})
 
-	if decoderFinder.decoderName != "" {
-		aliases[decoderFinder.decoderName] = struct{}{}
-	}
-
-	if len(aliases) == 0 {
-		return nil, fmt.Errorf("failed to detect decoder function (no self-reassigning function with offset subtraction found)")
-	}
-
-	collector := &aliasCollector{
-		aliases: aliases,
-	}
-	collector.V = collector
-	p.VisitWith(collector)
-	return aliases, nil
-}
-
-type decoderFunctionFinder struct {
-	ast.NoopVisitor
-	decoderName string
-}
-
-func (v *decoderFunctionFinder) VisitStatement(n *ast.Statement) {
-	n.VisitChildrenWith(v)
-	if v.decoderName != "" {
-		return
+	indexMaps, err := extractIndexMaps(g.root, g.src, rotationExpr, g.aliases, offset, len(table))
+	if err != nil {
+		return nil, err
 	}
 
-	fnDecl, ok := n.Stmt.(*ast.FunctionDeclaration)
-	if !ok || fnDecl.Function == nil || fnDecl.Function.Name == nil {
-		return
+	rotated, err := evaluateRotation(g, table, indexMaps, encoding, stepBudget)
+	if errors.Is(err, errNoRotationIIFE) {
+		rotated, err = rotateTableDynamic(table, offset, target, indexMaps, rotationExpr, g.aliases, encoding, g.work)
 	}
-
-	fnName := fnDecl.Function.Name.Name
-	if fnDecl.Function.Body == nil {
-		return
+	if err != nil {
+		return nil, err
 	}
+	table = rotated
 
-	if v.isDecoderFunction(fnDecl.Function.Body, fnName) {
-		v.decoderName = fnName
+	m := make(map[float64]string, len(table))
+	for idx, val := range table {
+		if !encoding.keyed() {
+			if val, err = encoding.decode(val, ""); err != nil {
+				return nil, fmt.Errorf("string-table entry %d: %w", idx+offset, err)
+			}
+		}
+		m[float64(idx+offset)] = val
 	}
+	return m, nil
 }
 
-func (v *decoderFunctionFinder) isDecoderFunction(body *ast.BlockStatement, fnName string) bool {
-	if body == nil {
-		return false
-	}
-
-	hasSelfReassign := false
-	hasOffsetSubtract := false
-
-	checker := &decoderPatternChecker{
-		fnName: fnName,
+// extractIndexMaps resolves the objects whose members the rotation expression passes to the
+// decoder, e.g. `fe(WK.a)`. Each is matched to an object literal bound to the same name that
+// defines every referenced key as an index into the table. The result is keyed by object name.
+func extractIndexMaps(root ast.VisitableNode, src *SourceFile, rotationExpr ast.Expression, aliases map[string]struct{}, offset, tableLen int) (map[string]map[string]int, error) {
+	isAlias := astmatch.Where(func(id *ast.Identifier) bool {
+		_, ok := aliases[id.Name]
+		return ok
+	})
+	decoderMemberArg := astmatch.Call(isAlias,
+		astmatch.Member(astmatch.Capture("object", astmatch.Ident()), astmatch.Capture("key", astmatch.Any())),
+		astmatch.Rest(),
+	)
+	refs := make(map[string]map[string]struct{})
+	firstRef := make(map[string]ast.VisitableNode)
+	for _, m := range astmatch.FindAll(&rotationExpr, decoderMemberArg) {
+		obj, _ := astmatch.Get[*ast.Identifier](m.Captures, "object")
+		key, ok := astmatch.PropName(m.Captures["key"])
+		if !ok {
+			continue
+		}
+		if refs[obj.Name] == nil {
+			refs[obj.Name] = make(map[string]struct{})
+			firstRef[obj.Name] = m.Node
+		}
+		refs[obj.Name][key] = struct{}{}
 	}
-	checker.V = checker
-	body.VisitWith(checker)
-
-	hasSelfReassign = checker.hasSelfReassign
-	hasOffsetSubtract = checker.hasOffsetSubtract
-
-	return hasSelfReassign && hasOffsetSubtract
-}
-
-type decoderPatternChecker struct {
-	ast.NoopVisitor
-	fnName            string
-	hasSelfReassign   bool
-	hasOffsetSubtract bool
-}
-
-func (v *decoderPatternChecker) VisitStatement(n *ast.Statement) {
-	n.VisitChildrenWith(v)
-}
-
-func (v *decoderPatternChecker) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok || assign.Operator.String() != "=" {
-		return
+	if len(refs) == 0 {
+		return nil, nil
 	}
 
-	if left, ok := assign.Left.Expr.(*ast.Identifier); ok && left.Name == v.fnName {
-		if fn, ok := assign.Right.Expr.(*ast.FunctionLiteral); ok {
-			v.hasSelfReassign = true
-			if fn.Body != nil {
-				fn.Body.VisitWith(v)
-			}
+	binding := astmatch.AnyOf(
+		astmatch.Declarator(astmatch.Capture("name", astmatch.Ident()), astmatch.Capture("object", astmatch.Is[*ast.ObjectLiteral]())),
+		astmatch.Assign("=", astmatch.Capture("name", astmatch.Ident()), astmatch.Capture("object", astmatch.Is[*ast.ObjectLiteral]())),
+	)
+	indexMaps := make(map[string]map[string]int)
+	for _, m := range astmatch.FindAll(root, binding) {
+		name, _ := astmatch.Get[*ast.Identifier](m.Captures, "name")
+		props, ok := refs[name.Name]
+		if !ok || indexMaps[name.Name] != nil {
+			continue
+		}
+		obj, _ := astmatch.Get[*ast.ObjectLiteral](m.Captures, "object")
+		if idx, ok := tableIndexMap(obj, props, offset, tableLen); ok {
+			indexMaps[name.Name] = idx
 		}
 	}
 
-	if left, ok := assign.Left.Expr.(*ast.Identifier); ok {
-		if binary, ok := assign.Right.Expr.(*ast.BinaryExpression); ok && binary.Operator.String() == "-" {
-			if rightId, ok := binary.Left.Expr.(*ast.Identifier); ok && rightId.Name == left.Name {
-				if num, ok := binary.Right.Expr.(*ast.NumberLiteral); ok {
-					if num.Value > 50 && num.Value < 2000 {
-						v.hasOffsetSubtract = true
-					}
-				}
+	for name, props := range refs {
+		if _, ok := indexMaps[name]; !ok {
+			keys := make([]string, 0, len(props))
+			for k := range props {
+				keys = append(keys, k)
 			}
+			slices.Sort(keys)
+			return nil, src.errorAt(firstRef[name], fmt.Errorf("rotation expression indexes the decoder through %s, but no object literal bound to %s defines %s as table indices", name, name, strings.Join(keys, ", ")))
 		}
 	}
+	return indexMaps, nil
 }
 
-type aliasCollector struct {
-	ast.NoopVisitor
-	aliases map[string]struct{}
-}
-
-func (v *aliasCollector) VisitStatement(n *ast.Statement) {
-	n.VisitChildrenWith(v)
-}
-
-func (v *aliasCollector) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok || assign.Operator.String() != "=" {
-		return
-	}
-
-	left, ok := assign.Left.Expr.(*ast.Identifier)
-	if !ok {
-		return
-	}
-
-	rightExpr := unwrapSequenceTail(assign.Right.Expr)
-
-	right, ok := rightExpr.(*ast.Identifier)
-	if !ok {
-		return
-	}
-
-	if _, exists := v.aliases[right.Name]; exists {
-		v.aliases[left.Name] = struct{}{}
-	}
-}
-
-func buildstringsDynamic(p *ast.Program, offset, target int, rotationExpr ast.Expression, aliases map[string]struct{}) map[float64]string {
-	raw := extractStringTable(p)
-	if raw == "" {
-		return nil
-	}
-
-	table := strings.Split(raw, ",")
-
-	wkMap := extractWKMap(p, offset, len(table))
-
-	table = rotateTableDynamic(table, offset, target, wkMap, rotationExpr, aliases)
-
-	m := make(map[float64]string, len(table))
-	for idx, val := range table {
-		m[float64(idx+offset)] = val
-	}
-	return m
-}
-
-func extractWKMap(p *ast.Program, offset, tableLen int) map[string]int {
-	finder := &wkMapFinder{
-		offset:   offset,
-		tableLen: tableLen,
-	}
-	finder.V = finder
-	p.VisitWith(finder)
-	return finder.wkMap
-}
-
-type wkMapFinder struct {
-	ast.NoopVisitor
-	wkMap    map[string]int
-	offset   int
-	tableLen int
-}
-
-func (v *wkMapFinder) VisitStatement(n *ast.Statement) {
-	n.VisitChildrenWith(v)
-}
-
-func (v *wkMapFinder) tryExtractWK(obj *ast.ObjectLiteral) {
-	wkMap := make(map[string]int)
+// tableIndexMap reads the numeric entries of obj. It fails unless every key in props is one
+// of them and indexes into the table.
+func tableIndexMap(obj *ast.ObjectLiteral, props map[string]struct{}, offset, tableLen int) (map[string]int, bool) {
+	m := make(map[string]int)
 	for _, entry := range obj.Value {
 		prop, ok := entry.Prop.(*ast.PropertyKeyed)
 		if !ok {
 			continue
 		}
-
-		var keyName string
-		switch key := prop.Key.Expr.(type) {
-		case *ast.Identifier:
-			keyName = key.Name
-		case *ast.StringLiteral:
-			keyName = key.Value
-		default:
+		keyName, ok := literalKeyName(prop.Key)
+		if !ok || prop.Value == nil {
 			continue
 		}
-
-		valNum, ok := prop.Value.Expr.(*ast.NumberLiteral)
+		val, ok := evalNumericLiteral(prop.Value.Expr)
 		if !ok {
 			continue
 		}
-		wkMap[keyName] = int(valNum.Value)
+		m[keyName] = int(val)
 	}
 
-	maxIdx := v.offset + v.tableLen
-	allValid := true
-	for _, val := range wkMap {
-		if val < v.offset || val >= maxIdx {
-			allValid = false
-			break
+	for key := range props {
+		idx, ok := m[key]
+		if !ok || idx < offset || idx >= offset+tableLen {
+			return nil, false
 		}
 	}
-
-	if !allValid {
-		return
-	}
-
-	if v.wkMap == nil && len(wkMap) >= 9 && len(wkMap) <= 13 {
-		v.wkMap = wkMap
-	}
+	return m, true
 }
 
-func (v *wkMapFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-
-	if obj, ok := n.Expr.(*ast.ObjectLiteral); ok {
-		v.tryExtractWK(obj)
-		return
-	}
-
-	assign, ok := n.Expr.(*ast.AssignExpression)
-	if !ok {
-		return
-	}
-
-	obj, ok := assign.Right.Expr.(*ast.ObjectLiteral)
-	if !ok {
-		return
-	}
-
-	v.tryExtractWK(obj)
-}
-
-func extractStringTable(p *ast.Program) string {
-	finder := &stringTableFinder{}
-	finder.V = finder
-	p.VisitWith(finder)
-	return finder.value
-}
-
-type stringTableFinder struct {
-	ast.NoopVisitor
-	value string
-}
-
-func (v *stringTableFinder) VisitExpression(n *ast.Expression) {
-	n.VisitChildrenWith(v)
-	if v.value != "" {
-		return
-	}
-
-	call, ok := n.Expr.(*ast.CallExpression)
-	if !ok || len(call.ArgumentList) != 1 {
-		return
-	}
-
-	member, ok := call.Callee.Expr.(*ast.MemberExpression)
-	if !ok {
-		return
-	}
-
-	objectLit, ok := member.Object.Expr.(*ast.StringLiteral)
-	if !ok {
-		return
-	}
-
-	prop, ok := member.Property.Prop.(*ast.Identifier)
-	if !ok || prop.Name != "split" {
-		return
-	}
+// stringTableSplit matches the string table literal, `'a,b,c'.split(',')`.
+var stringTableSplit = astmatch.Call(
+	astmatch.Member(astmatch.Capture("table", astmatch.Str()), astmatch.Prop("split")),
+	astmatch.Str(","),
+)
 
-	arg, ok := call.ArgumentList[0].Expr.(*ast.StringLiteral)
-	if !ok || arg.Value != "," {
-		return
+// stringTableArray matches a string table written out as an array, `['a','b','c']`.
+var stringTableArray = astmatch.Where(func(arr *ast.ArrayLiteral) bool {
+	for i := range arr.Value {
+		if _, ok := arr.Value[i].Expr.(*ast.StringLiteral); !ok {
+			return false
+		}
 	}
+	return len(arr.Value) > 1
+})
 
-	if len(objectLit.Value) > len(v.value) {
-		v.value = objectLit.Value
+// longestStringTable returns the string table under root with the most entries, written either
+// as a split literal or as an array of string literals.
+func longestStringTable(root ast.VisitableNode) []string {
+	var longest []string
+	for _, m := range astmatch.FindAll(root, astmatch.AnyOf(stringTableSplit, stringTableArray)) {
+		var table []string
+		if arr, ok := m.Node.(*ast.ArrayLiteral); ok {
+			for i := range arr.Value {
+				table = append(table, arr.Value[i].Expr.(*ast.StringLiteral).Value)
+			}
+		} else {
+			lit, _ := astmatch.Get[*ast.StringLiteral](m.Captures, "table")
+			table = strings.Split(lit.Value, ",")
+		}
+		if len(table) > len(longest) {
+			longest = table
+		}
 	}
+	return longest
 }
 
-func rotateTableDynamic(table []string, offset, target int, wkMap map[string]int, rotationExpr ast.Expression, aliases map[string]struct{}) []string {
-	const maxCycles = 20000
-
-	val := func(idx int) float64 {
+// rotateTableDynamic rotates the table until the rotation expression evaluates to target. A
+// full period without a match means the expression was not understood, so it is an error rather
+// than a guess. Rotations are tried by index, so only the rotation found is copied.
+func rotateTableDynamic(table []string, offset, target int, indexMaps map[string]map[string]int, rotationExpr ast.Expression, aliases map[string]struct{}, encoding *stringEncoding, work *workBudget) ([]string, error) {
+	// shift is the number of times the script's loop has moved the first entry to the end.
+	shift := 0
+	val := func(idx int, key string) float64 {
 		pos := idx - offset
 		if pos < 0 || pos >= len(table) {
-			return 0
+			// The decoder returns undefined, which parseInt turns into NaN.
+			return math.NaN()
 		}
-		return jsParseInt(table[pos])
-	}
-
-	for i := 0; i < maxCycles; i++ {
-		sum := 0.0
-
-		if rotationExpr.Expr != nil {
-			sum = evalRotationExpr(rotationExpr.Expr, wkMap, aliases, val)
+		s, err := encoding.decode(table[(pos+shift)%len(table)], key)
+		if err != nil {
+			// The decoder throws, which the rotation loop treats as a mismatch.
+			return math.NaN()
 		}
+		return jsnum.ParseInt(s, 0)
+	}
 
-		if int(math.Round(sum)) == target {
-			break
+	for ; shift < len(table); shift++ {
+		if err := work.spend(1); err != nil {
+			return nil, err
 		}
-
-		if len(table) > 0 {
-			table = append(table[1:], table[0])
+		sum := evalRotationExpr(rotationExpr.Expr, indexMaps, aliases, val)
+		if sum == float64(target) {
+			return slices.Concat(table[shift:], table[:shift]), nil
 		}
 	}
 
-	return table
+	return nil, fmt.Errorf("no rotation of the %d-entry string table makes the rotation expression equal %d", len(table), target)
 }
 
-func evalRotationExpr(expr ast.Node, wkMap map[string]int, aliases map[string]struct{}, val func(int) float64) float64 {
+func evalRotationExpr(expr ast.Node, indexMaps map[string]map[string]int, aliases map[string]struct{}, val func(int, string) float64) float64 {
 	switch e := expr.(type) {
 	case *ast.Expression:
-		return evalRotationExpr(e.Expr, wkMap, aliases, val)
+		return evalRotationExpr(e.Expr, indexMaps, aliases, val)
 	case *ast.NumberLiteral:
 		return e.Value
 	case *ast.UnaryExpression:
 		switch e.Operator.String() {
 		case "-":
-			return -evalRotationExpr(e.Operand, wkMap, aliases, val)
+			return -evalRotationExpr(e.Operand, indexMaps, aliases, val)
 		case "+":
-			return evalRotationExpr(e.Operand, wkMap, aliases, val)
+			return evalRotationExpr(e.Operand, indexMaps, aliases, val)
 		default:
-			return 0
+			return math.NaN()
 		}
 	case *ast.BinaryExpression:
-		l := evalRotationExpr(e.Left, wkMap, aliases, val)
-		r := evalRotationExpr(e.Right, wkMap, aliases, val)
+		l := evalRotationExpr(e.Left, indexMaps, aliases, val)
+		r := evalRotationExpr(e.Right, indexMaps, aliases, val)
 		switch e.Operator.String() {
 		case "+":
 			return l + r
@@ -1254,44 +929,52 @@ func evalRotationExpr(expr ast.Node, wkMap map[string]int, aliases map[string]st
 		case "*":
 			return l * r
 		case "/":
-			if r != 0 {
-				return l / r
-			}
-			return 0
+			return l / r
+		case "%":
+			return math.Mod(l, r)
 		default:
-			return 0
+			return math.NaN()
 		}
 	case *ast.CallExpression:
 		if id, ok := e.Callee.Expr.(*ast.Identifier); ok && id.Name == "parseInt" && len(e.ArgumentList) >= 1 {
-			arg := evalRotationExpr(&e.ArgumentList[0], wkMap, aliases, val)
+			arg := evalRotationExpr(&e.ArgumentList[0], indexMaps, aliases, val)
 			return arg
 		}
 
 		if id, ok := e.Callee.Expr.(*ast.Identifier); ok {
 			if _, exists := aliases[id.Name]; exists {
-				if len(e.ArgumentList) == 1 {
-					if idx := evalIndex(&e.ArgumentList[0], wkMap); idx != -1 {
-						return val(idx)
+				var key string
+				if len(e.ArgumentList) == 2 {
+					lit, ok := e.ArgumentList[1].Expr.(*ast.StringLiteral)
+					if !ok {
+						return math.NaN()
+					}
+					key = lit.Value
+				}
+				if len(e.ArgumentList) >= 1 && len(e.ArgumentList) <= 2 {
+					if idx := evalIndex(&e.ArgumentList[0], indexMaps); idx != -1 {
+						return val(idx, key)
 					}
 				}
 			}
 		}
-		return 0
+		return math.NaN()
 	case *ast.MemberExpression:
-		return float64(evalIndexFromMember(e, wkMap))
-	case *ast.Identifier:
-		return 0
+		if idx := evalIndexFromMember(e, indexMaps); idx != -1 {
+			return float64(idx)
+		}
+		return math.NaN()
 	default:
-		return 0
+		return math.NaN()
 	}
 }
 
-func evalIndex(n ast.Node, wkMap map[string]int) int {
+func evalIndex(n ast.Node, indexMaps map[string]map[string]int) int {
 	switch v := n.(type) {
 	case *ast.Expression:
-		return evalIndex(v.Expr, wkMap)
+		return evalIndex(v.Expr, indexMaps)
 	case *ast.MemberExpression:
-		return evalIndexFromMember(v, wkMap)
+		return evalIndexFromMember(v, indexMaps)
 	case *ast.NumberLiteral:
 		return int(v.Value)
 	default:
@@ -1299,16 +982,20 @@ func evalIndex(n ast.Node, wkMap map[string]int) int {
 	}
 }
 
-func evalIndexFromMember(m *ast.MemberExpression, wkMap map[string]int) int {
+func evalIndexFromMember(m *ast.MemberExpression, indexMaps map[string]map[string]int) int {
 	obj, ok := m.Object.Expr.(*ast.Identifier)
-	if !ok || obj.Name != "WK" {
+	if !ok {
 		return -1
 	}
 	propName, ok := memberPropName(m.Property)
 	if !ok {
 		return -1
 	}
-	return wkMap[propName]
+	idx, ok := indexMaps[obj.Name][propName]
+	if !ok {
+		return -1
+	}
+	return idx
 }
 
 func memberPropName(mp *ast.MemberProperty) (string, bool) {
@@ -1345,29 +1032,37 @@ func unwrapSequenceTail(expr ast.Expr) ast.Expr {
 	}
 }
 
-func jsParseInt(val string) float64 {
-	if val == "" {
-		return 0
-	}
+func (v *deobVisitor) isAlias(name string) bool {
+	_, ok := v.aliases[name]
+	return ok
+}
 
-	sign := 1
-	if val[0] == '-' {
-		sign = -1
-		val = val[1:]
+// decoderIndex folds the arguments of a decoder, alias or wrapper call down to the table index
+// it requests. Arguments that would be dropped by the rewrite must be free of side effects.
+func (v *deobVisitor) decoderIndex(name string, args ast.Expressions) (float64, bool) {
+	if len(args) == 0 {
+		return 0, false
 	}
 
-	result := 0
-	for i := 0; i < len(val); i++ {
-		if val[i] < '0' || val[i] > '9' {
-			break
+	if v.isAlias(name) {
+		if len(args) > 1 && (v.extraArgsUsed || !allSideEffectFree(args[1:])) {
+			return 0, false
 		}
-		result = result*10 + int(val[i]-'0')
+		return foldConstant(args[0].Expr, nil)
 	}
 
-	return float64(sign * result)
+	w := v.wrappers[name]
+	if w == nil || (len(w.extra) > 0 && v.extraArgsUsed) || !allSideEffectFree(args) {
+		return 0, false
+	}
+	return w.resolveIndex(args)
 }
 
-func (v *deobVisitor) isAlias(name string) bool {
-	_, ok := v.aliases[name]
-	return ok
+func allSideEffectFree(exprs ast.Expressions) bool {
+	for i := range exprs {
+		if !isSideEffectFree(exprs[i].Expr) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,192 @@
+package visitors
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+type encodingKind int
+
+const (
+	encodingBase64 encodingKind = iota + 1
+	encodingRC4
+)
+
+func (k encodingKind) String() string {
+	switch k {
+	case encodingBase64:
+		return "base64"
+	case encodingRC4:
+		return "rc4"
+	}
+	return "plain"
+}
+
+// stringEncoding is how a decoder encodes string-table entries, in the two schemes string-array
+// obfuscators use. base64 entries are base64 over a custom alphabet of the UTF-8 bytes of the
+// string, which the decoder turns back into text with decodeURIComponent. rc4 entries are base64
+// decoded the same way and then RC4-decrypted with a key passed as the decoder's second argument,
+// so every call site picks its own key.
+type stringEncoding struct {
+	kind     encodingKind
+	alphabet string
+}
+
+// keyed reports whether entries can only be decoded together with a per-call key. It is false
+// for a nil encoding, i.e. a plain table.
+func (e *stringEncoding) keyed() bool {
+	return e != nil && e.kind == encodingRC4
+}
+
+// decode returns the string the decoder produces for the table entry raw. key is ignored
+// unless the encoding is keyed.
+func (e *stringEncoding) decode(raw, key string) (string, error) {
+	if e == nil {
+		return raw, nil
+	}
+	s, err := e.decodeBase64(raw)
+	if err != nil || e.kind != encodingRC4 {
+		return s, err
+	}
+	if key == "" {
+		return "", fmt.Errorf("rc4 entry %q needs a key", raw)
+	}
+	return rc4(s, key), nil
+}
+
+// decodeBase64 mirrors the decoder's loop, `~c && (b = n % 4 ? b * 64 + c : c, n++ % 4) ?
+// out += String.fromCharCode(255 & b >> (-2 * n & 6)) : 0`, including its handling of characters
+// outside the alphabet (skipped) and of padding (decoded like any other character).
+func (e *stringEncoding) decodeBase64(raw string) (string, error) {
+	var out []byte
+	var bits, n int32
+	for i := 0; i < len(raw); i++ {
+		c := int32(strings.IndexByte(e.alphabet, raw[i]))
+		if c < 0 {
+			continue
+		}
+		if n%4 != 0 {
+			bits = bits*64 + c
+		} else {
+			bits = c
+		}
+		n++
+		if (n-1)%4 != 0 {
+			out = append(out, byte(bits>>(-2*n&6)))
+		}
+	}
+	// The decoder percent-encodes every byte and passes the result to decodeURIComponent, which
+	// throws a URIError unless the bytes are UTF-8.
+	if !utf8.Valid(out) {
+		return "", fmt.Errorf("base64 entry %q does not decode to UTF-8", raw)
+	}
+	return string(out), nil
+}
+
+// rc4 decrypts the UTF-16 code units of s, keyed by the code units of key, as the decoder does
+// with charCodeAt and String.fromCharCode.
+func rc4(s, key string) string {
+	k := utf16.Encode([]rune(key))
+	var box [256]int
+	for i := range box {
+		box[i] = i
+	}
+	j := 0
+	for i := range box {
+		j = (j + box[i] + int(k[i%len(k)])) % 256
+		box[i], box[j] = box[j], box[i]
+	}
+
+	in := utf16.Encode([]rune(s))
+	out := make([]uint16, len(in))
+	i, j := 0, 0
+	for y, c := range in {
+		i = (i + 1) % 256
+		j = (j + box[i]) % 256
+		box[i], box[j] = box[j], box[i]
+		out[y] = c ^ uint16(box[(box[i]+box[j])%256])
+	}
+	return string(utf16.Decode(out))
+}
+
+// detectStringEncoding inspects the decoder's function declaration, including the helpers it
+// defines on first call. A base64 alphabet literal together with a decodeURIComponent call means
+// the entries are base64 encoded; a `% 256` on top of that is the RC4 key schedule. It returns
+// nil for a plain table.
+func detectStringEncoding(fn *ast.FunctionLiteral) (*stringEncoding, error) {
+	alphabet, ok := astmatch.FindFirst(fn, astmatch.Where(func(lit *ast.StringLiteral) bool {
+		return validateBase64Alphabet(lit.Value) == nil
+	}))
+	if !ok {
+		return nil, nil
+	}
+	enc := &stringEncoding{kind: encodingBase64, alphabet: alphabet.Node.(*ast.StringLiteral).Value}
+	if _, ok := astmatch.FindFirst(fn, astmatch.Call(astmatch.Ident("decodeURIComponent"), astmatch.Any())); !ok {
+		return nil, fmt.Errorf("decoder %s embeds the base64 alphabet %q but never calls decodeURIComponent", fn.Name.Name, enc.alphabet)
+	}
+
+	keySchedule := astmatch.Binary("%", astmatch.Any(), astmatch.Where(func(n *ast.NumberLiteral) bool { return n.Value == 256 }))
+	if _, ok := astmatch.FindFirst(fn, keySchedule); ok {
+		enc.kind = encodingRC4
+	}
+	return enc, nil
+}
+
+// keyedString resolves a call to a decoder that takes a per-call key. The key must be a string
+// literal at the call site, or reach the decoder through a wrapper parameter bound to one.
+func (v *deobVisitor) keyedString(name string, args ast.Expressions) (float64, string, bool) {
+	if len(args) < 2 {
+		return 0, "", false
+	}
+
+	var idx float64
+	var keyArg *ast.Expression
+	if v.isAlias(name) {
+		var ok bool
+		if idx, ok = foldConstant(args[0].Expr, nil); !ok {
+			return 0, "", false
+		}
+		keyArg = &args[1]
+	} else {
+		w := v.wrappers[name]
+		if w == nil || len(w.extra) == 0 || !allSideEffectFree(args) {
+			return 0, "", false
+		}
+		var ok bool
+		if idx, ok = w.resolveIndex(args); !ok {
+			return 0, "", false
+		}
+		keyArg = &w.extra[0]
+		if id, ok := keyArg.Expr.(*ast.Identifier); ok {
+			keyArg = nil
+			for i, param := range w.params {
+				if param == id.Name && i < len(args) {
+					keyArg = &args[i]
+				}
+			}
+		}
+	}
+	if keyArg == nil {
+		return 0, "", false
+	}
+	key, ok := keyArg.Expr.(*ast.StringLiteral)
+	if !ok {
+		return 0, "", false
+	}
+
+	raw, ok := v.strings[idx]
+	if !ok {
+		return 0, "", false
+	}
+	s, err := v.encoding.decode(raw, key.Value)
+	if err != nil {
+		return 0, "", false
+	}
+	return idx, s, true
+}
@@ -0,0 +1,346 @@
+package visitors
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/t14raptor/go-fast/ast"
+	fastgen "github.com/t14raptor/go-fast/generator"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+const (
+	// DefaultEngineTimeout is the time limit of the engine fallback when EngineOptions.Timeout
+	// is zero.
+	DefaultEngineTimeout = 2 * time.Second
+	// DefaultEngineCallDepth is the call stack limit of the engine fallback when
+	// EngineOptions.MaxCallDepth is zero.
+	DefaultEngineCallDepth = 1024
+)
+
+// EngineOptions configures the engine fallback for string-table decoding. It runs the script's
+// own string-table function, rotation IIFE and decoder in goja, an ECMAScript engine written in
+// Go, with only the language built-ins: no DOM, network, timers or host objects. It asks the
+// decoder for every index of the table, or only for the indices the script passes to it when
+// the decoder offset is unknown, and calls the character function passed to the LZ compressor
+// for every position of the alphabet, before the strings are substituted.
+//
+// When static extraction fails, the harvested strings and alphabet replace the static ones.
+// When both succeed, every harvested string and the alphabet must match the static results or
+// deobfuscation fails. An engine failure alone is not an error.
+//
+// Decoders that take a per-call key, such as RC4 string tables, are only decoded statically.
+//
+// The engine is bounded by Timeout and MaxCallDepth only. Nothing bounds its memory or counts
+// its steps, so a script that allocates quickly can use a lot of memory before the timer stops
+// it; Limits.MaxSteps does not apply to it.
+type EngineOptions struct {
+	Enabled bool
+	// Timeout caps the wall-clock time of the engine for each string group, from running the
+	// rotation IIFE to harvesting the alphabet. Zero means DefaultEngineTimeout.
+	Timeout time.Duration
+	// MaxCallDepth caps the call stack of the engine. Zero means DefaultEngineCallDepth.
+	MaxCallDepth int
+}
+
+// errEngineTimeout interrupts the engine when its group runs out of time.
+var errEngineTimeout = errors.New("engine timed out")
+
+// jsEngine is the engine fallback of one string group, after its rotation IIFE ran.
+type jsEngine struct {
+	vm      *goja.Runtime
+	timer   *time.Timer
+	timeout time.Duration
+	// work is the budget of the run. When its deadline comes before the engine's own, running
+	// out of time is a *LimitError of the run rather than an engine failure.
+	work      *workBudget
+	workFirst bool
+}
+
+// reconcileEngineStrings runs the engine fallback next to the group's static string table,
+// which is either g.strings or staticErr. It reports whether g.strings now came from the engine.
+// The engine is kept in g.engine for the alphabet.
+func reconcileEngineStrings(g *stringGroup, staticErr error, opts EngineOptions) (bool, error) {
+	var limit *LimitError
+	if errors.As(staticErr, &limit) {
+		return false, staticErr
+	}
+	g.collectAliases()
+
+	decoded, err := decodeWithEngine(g, opts)
+	switch {
+	case errors.As(err, &limit):
+		return false, err
+	case staticErr != nil && err != nil:
+		return false, fmt.Errorf("%w (engine fallback: %v)", staticErr, err)
+	case staticErr != nil:
+		g.strings = decoded
+		return true, nil
+	case err != nil:
+		return false, nil
+	}
+
+	if err := crossCheckStrings(g.strings, decoded); err != nil {
+		return false, fmt.Errorf("failed at step 5: %w", err)
+	}
+	return false, nil
+}
+
+// decodeWithEngine loads the function declarations of the group's scope and the aliases of its
+// decoder into a new engine, runs the rotation IIFE, then calls the decoder with every index of
+// the table, from the offset to the offset plus the table length. Without an offset it uses the
+// constant indices found at decoder and alias call sites instead.
+func decodeWithEngine(g *stringGroup, opts EngineOptions) (map[float64]string, error) {
+	if g.tableFn == "" {
+		g.findTable()
+	}
+	if g.tableFn == "" {
+		return nil, fmt.Errorf("no string-table function found")
+	}
+	call := findRotationIIFE(g.root, g.tableFn)
+	if call == nil {
+		return nil, errNoRotationIIFE
+	}
+
+	var src strings.Builder
+	for _, stmt := range g.body {
+		if decl, ok := stmt.Stmt.(*ast.FunctionDeclaration); ok {
+			src.WriteString(fastgen.Generate(decl))
+			src.WriteString("\n")
+		}
+	}
+	for _, alias := range slices.Sorted(maps.Keys(g.aliases)) {
+		if alias != g.decoder {
+			fmt.Fprintf(&src, "var %s = %s;\n", alias, g.decoder)
+		}
+	}
+
+	e := newJSEngine(g.work, opts)
+	g.engine = e
+	if _, err := e.run(func() (goja.Value, error) { return e.vm.RunString(src.String()) }); err != nil {
+		return nil, fmt.Errorf("loading functions: %w", err)
+	}
+	if _, err := e.run(func() (goja.Value, error) { return e.vm.RunString("(" + fastgen.Generate(call) + ");") }); err != nil {
+		return nil, fmt.Errorf("rotation IIFE: %w", err)
+	}
+
+	decoder, ok := goja.AssertFunction(e.vm.Get(g.decoder))
+	if !ok {
+		return nil, fmt.Errorf("%s is not a function after the rotation IIFE ran", g.decoder)
+	}
+	indices, err := e.tableIndices(g)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make(map[float64]string)
+	for _, idx := range indices {
+		v, err := e.run(func() (goja.Value, error) { return decoder(goja.Undefined(), e.vm.ToValue(idx)) })
+		if err != nil {
+			return nil, fmt.Errorf("decoding index %v: %w", idx, err)
+		}
+		if s, ok := v.Export().(string); ok {
+			decoded[idx] = s
+		}
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("decoder returned no strings")
+	}
+	return decoded, nil
+}
+
+// tableIndices returns the indices the decoder accepts: the offset up to the offset plus the
+// length of the rotated table, or the call-site indices when the offset is unknown.
+func (e *jsEngine) tableIndices(g *stringGroup) ([]float64, error) {
+	if g.offset == 0 {
+		return decoderCallIndices(g.root, g.decoder, g.aliases), nil
+	}
+	v, err := e.run(func() (goja.Value, error) { return e.vm.RunString(g.tableFn + "().length") })
+	if err != nil {
+		return nil, fmt.Errorf("reading table length: %w", err)
+	}
+	n := v.ToInteger()
+	if n <= 0 {
+		return nil, fmt.Errorf("%s returned an empty table", g.tableFn)
+	}
+	indices := make([]float64, n)
+	for i := range indices {
+		indices[i] = float64(g.offset + i)
+	}
+	return indices, nil
+}
+
+func newJSEngine(work *workBudget, opts EngineOptions) *jsEngine {
+	timeout, depth := opts.Timeout, opts.MaxCallDepth
+	if timeout <= 0 {
+		timeout = DefaultEngineTimeout
+	}
+	if depth <= 0 {
+		depth = DefaultEngineCallDepth
+	}
+	e := &jsEngine{vm: goja.New(), timeout: timeout, work: work}
+	e.vm.SetMaxCallStackSize(depth)
+
+	deadline := time.Now().Add(timeout)
+	if work != nil && !work.deadline.IsZero() && work.deadline.Before(deadline) {
+		deadline, e.workFirst = work.deadline, true
+	}
+	e.timer = time.AfterFunc(time.Until(deadline), func() { e.vm.Interrupt(errEngineTimeout) })
+	return e
+}
+
+// run runs fn in the engine and turns its interruption into a timeout error.
+func (e *jsEngine) run(fn func() (goja.Value, error)) (goja.Value, error) {
+	v, err := fn()
+	var interrupted *goja.InterruptedError
+	if !errors.As(err, &interrupted) {
+		return v, err
+	}
+	if e.workFirst {
+		if err := e.work.check(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("did not finish within %v", e.timeout)
+}
+
+// close stops the engine's timer. A nil engine is a no-op.
+func (e *jsEngine) close() {
+	if e != nil {
+		e.timer.Stop()
+	}
+}
+
+// harvestAlphabet evaluates each LZ character function in the engine and calls it with every
+// position of the alphabet. It returns the first result that is a valid alphabet.
+func (e *jsEngine) harvestAlphabet(charFns []lzCharFunction) (string, lzCharFunction, error) {
+	var rejected []string
+	for _, c := range charFns {
+		v, err := e.run(func() (goja.Value, error) { return e.vm.RunString("(" + fastgen.Generate(c.fn) + ")") })
+		var limit *LimitError
+		if errors.As(err, &limit) {
+			return "", lzCharFunction{}, err
+		} else if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", c.compressor, err))
+			continue
+		}
+		fn, ok := goja.AssertFunction(v)
+		if !ok {
+			continue
+		}
+
+		var alphabet strings.Builder
+		for i := range 65 {
+			v, err = e.run(func() (goja.Value, error) { return fn(goja.Undefined(), e.vm.ToValue(i)) })
+			if err != nil {
+				break
+			}
+			s, ok := v.Export().(string)
+			if !ok || len(s) != 1 {
+				break
+			}
+			alphabet.WriteString(s)
+		}
+		if errors.As(err, &limit) {
+			return "", lzCharFunction{}, err
+		} else if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", c.compressor, err))
+			continue
+		}
+		if err := validateBase64Alphabet(alphabet.String()); err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", c.compressor, err))
+			continue
+		}
+		return alphabet.String(), c, nil
+	}
+	if len(rejected) > 0 {
+		return "", lzCharFunction{}, fmt.Errorf("no LZ alphabet (rejected %s)", strings.Join(rejected, "; "))
+	}
+	return "", lzCharFunction{}, fmt.Errorf("no LZ compressor found")
+}
+
+// harvestEngineAlphabet harvests the LZ alphabet in the engines of the groups, before their
+// strings are substituted. It returns "" when no engine ran or none found an alphabet.
+func harvestEngineAlphabet(p *ast.Program, groups []*stringGroup) (string, lzCharFunction, error) {
+	charFns := lzCharFunctions(p, collectBindings(p))
+	var limit *LimitError
+	for _, g := range groups {
+		if g.engine == nil {
+			continue
+		}
+		alphabet, c, err := g.engine.harvestAlphabet(charFns)
+		if errors.As(err, &limit) {
+			return "", lzCharFunction{}, err
+		}
+		if err == nil {
+			return alphabet, c, nil
+		}
+	}
+	return "", lzCharFunction{}, nil
+}
+
+// reconcileEngineAlphabet combines the static LZ alphabet, which is either alphabet or
+// staticErr, with the one harvested in the engine, if any. A mismatch is reported at the
+// character function the engine called.
+func reconcileEngineAlphabet(alphabet string, source LZAlphabetSource, staticErr error, harvested string, c lzCharFunction, src *SourceFile) (string, LZAlphabetSource, error) {
+	switch {
+	case harvested == "":
+		return alphabet, source, staticErr
+	case staticErr != nil:
+		return harvested, LZAlphabetSource{Compressor: c.compressor, Lookup: "engine", Offset: -1}, nil
+	case alphabet != harvested:
+		err := fmt.Errorf("LZ alphabet is %q statically but %q in the engine", alphabet, harvested)
+		if src != nil {
+			err = src.errorAt(c.fn, err)
+		}
+		return "", source, err
+	}
+	return alphabet, source, nil
+}
+
+// decoderCallIndices returns the sorted, distinct constant first arguments of decoder and
+// alias calls.
+func decoderCallIndices(root ast.VisitableNode, decoderName string, aliases map[string]struct{}) []float64 {
+	decoderCall := astmatch.Call(
+		astmatch.Where(func(id *ast.Identifier) bool {
+			_, isAlias := aliases[id.Name]
+			return isAlias || id.Name == decoderName
+		}),
+		astmatch.Capture("index", astmatch.Any()),
+		astmatch.Rest(),
+	)
+
+	var indices []float64
+	for _, m := range astmatch.FindAll(root, decoderCall) {
+		idx, ok := foldConstant(m.Captures["index"].(*ast.Expression).Expr, nil)
+		if ok && !slices.Contains(indices, idx) {
+			indices = append(indices, idx)
+		}
+	}
+	slices.Sort(indices)
+	return indices
+}
+
+func crossCheckStrings(static, decoded map[float64]string) error {
+	indices := make([]float64, 0, len(decoded))
+	for idx := range decoded {
+		indices = append(indices, idx)
+	}
+	slices.Sort(indices)
+
+	for _, idx := range indices {
+		s, ok := static[idx]
+		if !ok {
+			return fmt.Errorf("engine decodes index %v to %q, which the static string table does not have", idx, decoded[idx])
+		}
+		if s != decoded[idx] {
+			return fmt.Errorf("index %v decodes to %q statically but to %q in the engine", idx, s, decoded[idx])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1228 @@
+package visitors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/t14raptor/go-fast/ast"
+	"github.com/t14raptor/go-fast/token"
+
+	"github.com/fxnatic/jsd-solver-go/jsnum"
+)
+
+// The evaluator runs small pieces of the script itself, such as the IIFE that rotates the
+// string table, the way a browser would. It models only what those pieces need: locals and
+// closures, JS arithmetic and comparisons, arrays with push/pop/shift/unshift, a few string
+// methods, try/catch/throw, parseInt and parseFloat; callers provide every other global. Anything outside
+// that subset stops evaluation with an error, it never evaluates to a guess.
+
+const maxEvalCallDepth = 256
+
+type (
+	jsUndefined struct{}
+	jsNull      struct{}
+
+	jsArray struct {
+		elems []any
+	}
+
+	jsObject struct {
+		props map[string]any
+	}
+
+	jsFunction struct {
+		native func(args []any) (any, error)
+		lit    *ast.FunctionLiteral
+		scope  *evalScope
+	}
+)
+
+var undefined any = jsUndefined{}
+
+// jsThrow is a JavaScript exception. It is the only error try/catch can intercept; modeling
+// gaps and the step budget abort evaluation even inside a try block.
+type jsThrow struct {
+	value any
+}
+
+func (t *jsThrow) Error() string {
+	return "uncaught " + toJSString(t.value)
+}
+
+func typeError(format string, args ...any) *jsThrow {
+	return &jsThrow{value: "TypeError: " + fmt.Sprintf(format, args...)}
+}
+
+type evalScope struct {
+	vars   map[string]any
+	parent *evalScope
+	// function marks the scope `var` declarations belong to.
+	function bool
+}
+
+func newEvalScope(parent *evalScope, function bool) *evalScope {
+	return &evalScope{vars: make(map[string]any), parent: parent, function: function}
+}
+
+func (s *evalScope) lookup(name string) (*evalScope, bool) {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (s *evalScope) global() *evalScope {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+func (s *evalScope) functionScope() *evalScope {
+	for !s.function && s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+type completionKind int
+
+const (
+	normalCompletion completionKind = iota
+	breakCompletion
+	continueCompletion
+	returnCompletion
+)
+
+type completion struct {
+	kind  completionKind
+	label string
+	value any
+}
+
+type evaluator struct {
+	steps  int
+	budget int
+	depth  int
+	// lastCaught is the most recent exception swallowed by a catch block. A rotation loop
+	// catches everything, so it is the best hint at why a run never terminated.
+	lastCaught *jsThrow
+	// src, when set, resolves the positions of statements the evaluator cannot model.
+	src *SourceFile
+	// work is the budget of the whole deobfuscation run the evaluator is part of.
+	work *workBudget
+}
+
+// limitError is a run exceeding its step budget. It belongs to the run, not to
+// the statement that happened to hit it.
+type limitError struct {
+	msg string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+func (e *evaluator) step() error {
+	if err := e.work.spend(1); err != nil {
+		return err
+	}
+	e.steps++
+	if e.steps <= e.budget {
+		return nil
+	}
+	if e.lastCaught != nil {
+		return &limitError{fmt.Sprintf("did not finish within %d evaluation steps (last caught exception: %s)", e.budget, toJSString(e.lastCaught.value))}
+	}
+	return &limitError{fmt.Sprintf("did not finish within %d evaluation steps", e.budget)}
+}
+
+func evalParseInt(args []any) (any, error) {
+	if len(args) == 0 {
+		return math.NaN(), nil
+	}
+	var radix int32
+	if len(args) > 1 {
+		radix = jsnum.ToInt32(toJSNumber(args[1]))
+	}
+	return jsnum.ParseInt(toJSString(args[0]), radix), nil
+}
+
+func evalParseFloat(args []any) (any, error) {
+	if len(args) == 0 {
+		return math.NaN(), nil
+	}
+	return jsnum.ParseFloat(toJSString(args[0])), nil
+}
+
+func (e *evaluator) closure(lit *ast.FunctionLiteral, s *evalScope) *jsFunction {
+	fn := &jsFunction{lit: lit, scope: s}
+	if lit.Name != nil {
+		// A named function expression sees its own name in a scope of its own.
+		fn.scope = newEvalScope(s, false)
+		fn.scope.vars[lit.Name.Name] = fn
+	}
+	return fn
+}
+
+func (e *evaluator) callFunction(fn *jsFunction, args []any) (any, error) {
+	if fn.native != nil {
+		return fn.native(args)
+	}
+	if e.depth >= maxEvalCallDepth {
+		return nil, fmt.Errorf("exceeded a call depth of %d", maxEvalCallDepth)
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	lit := fn.lit
+	if lit.ParameterList.Rest != nil {
+		return nil, fmt.Errorf("rest parameters are not modeled")
+	}
+	s := newEvalScope(fn.scope, true)
+	for i, param := range lit.ParameterList.List {
+		id, ok := param.Target.Target.(*ast.Identifier)
+		if !ok {
+			return nil, fmt.Errorf("destructuring parameters are not modeled")
+		}
+		var v any = undefined
+		if i < len(args) {
+			v = args[i]
+		}
+		if _, ok := v.(jsUndefined); ok && param.Initializer != nil {
+			var err error
+			if v, err = e.eval(param.Initializer, s); err != nil {
+				return nil, err
+			}
+		}
+		s.vars[id.Name] = v
+	}
+
+	e.hoist(lit.Body.List, s)
+	c, err := e.execStatements(lit.Body.List, s)
+	if err != nil {
+		return nil, err
+	}
+	if c.kind == returnCompletion {
+		return c.value, nil
+	}
+	return undefined, nil
+}
+
+// hoist declares the `var` bindings and function declarations of a function body up front, as
+// JavaScript does before running it.
+func (e *evaluator) hoist(body ast.Statements, s *evalScope) {
+	h := &varHoister{}
+	h.V = h
+	for i := range body {
+		body[i].VisitWith(h)
+	}
+	for _, name := range h.vars {
+		if _, ok := s.vars[name]; !ok {
+			s.vars[name] = undefined
+		}
+	}
+	for _, fn := range h.funcs {
+		s.vars[fn.Name.Name] = &jsFunction{lit: fn, scope: s}
+	}
+}
+
+type varHoister struct {
+	ast.NoopVisitor
+	vars  []string
+	funcs []*ast.FunctionLiteral
+}
+
+func (v *varHoister) VisitVariableDeclaration(n *ast.VariableDeclaration) {
+	if n.Token == token.Var {
+		for _, d := range n.List {
+			if id, ok := d.Target.Target.(*ast.Identifier); ok {
+				v.vars = append(v.vars, id.Name)
+			}
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *varHoister) VisitFunctionDeclaration(n *ast.FunctionDeclaration) {
+	if n.Function != nil && n.Function.Name != nil {
+		v.funcs = append(v.funcs, n.Function)
+	}
+}
+
+func (v *varHoister) VisitFunctionLiteral(n *ast.FunctionLiteral)           {}
+func (v *varHoister) VisitArrowFunctionLiteral(n *ast.ArrowFunctionLiteral) {}
+
+func (e *evaluator) execStatements(list ast.Statements, s *evalScope) (completion, error) {
+	for i := range list {
+		c, err := e.exec(list[i].Stmt, s, "")
+		if err != nil || c.kind != normalCompletion {
+			return c, err
+		}
+	}
+	return completion{}, nil
+}
+
+// exec runs one statement. label is the label directly in front of it, which loops need to
+// match labelled continue statements. Modeling gaps come back at the innermost statement that
+// hit them.
+func (e *evaluator) exec(stmt ast.Stmt, s *evalScope, label string) (completion, error) {
+	c, err := e.execStmt(stmt, s, label)
+	if err != nil {
+		var thrown *jsThrow
+		var limit *limitError
+		var runLimit *LimitError
+		var located *PositionError
+		if !errors.As(err, &thrown) && !errors.As(err, &limit) && !errors.As(err, &runLimit) && !errors.As(err, &located) {
+			err = e.src.errorAt(stmt, err)
+		}
+	}
+	return c, err
+}
+
+func (e *evaluator) execStmt(stmt ast.Stmt, s *evalScope, label string) (completion, error) {
+	if err := e.step(); err != nil {
+		return completion{}, err
+	}
+
+	switch st := stmt.(type) {
+	case *ast.EmptyStatement, *ast.FunctionDeclaration:
+		return completion{}, nil
+	case *ast.ExpressionStatement:
+		_, err := e.eval(st.Expression, s)
+		return completion{}, err
+	case *ast.VariableDeclaration:
+		return completion{}, e.declare(st, s)
+	case *ast.BlockStatement:
+		return e.execStatements(st.List, newEvalScope(s, false))
+	case *ast.IfStatement:
+		test, err := e.eval(st.Test, s)
+		if err != nil {
+			return completion{}, err
+		}
+		if truthy(test) {
+			return e.exec(st.Consequent.Stmt, s, "")
+		}
+		if st.Alternate != nil {
+			return e.exec(st.Alternate.Stmt, s, "")
+		}
+		return completion{}, nil
+	case *ast.ForStatement:
+		return e.execFor(st, s, label)
+	case *ast.WhileStatement:
+		return e.execLoop(s, label, st.Test, st.Body, nil, false)
+	case *ast.DoWhileStatement:
+		return e.execLoop(s, label, st.Test, st.Body, nil, true)
+	case *ast.LabelledStatement:
+		c, err := e.exec(st.Statement.Stmt, s, st.Label.Name)
+		if err == nil && c.kind == breakCompletion && c.label == st.Label.Name {
+			c = completion{}
+		}
+		return c, err
+	case *ast.TryStatement:
+		return e.execTry(st, s)
+	case *ast.BreakStatement:
+		c := completion{kind: breakCompletion}
+		if st.Label != nil {
+			c.label = st.Label.Name
+		}
+		return c, nil
+	case *ast.ContinueStatement:
+		c := completion{kind: continueCompletion}
+		if st.Label != nil {
+			c.label = st.Label.Name
+		}
+		return c, nil
+	case *ast.ReturnStatement:
+		if st.Argument == nil {
+			return completion{kind: returnCompletion, value: undefined}, nil
+		}
+		v, err := e.eval(st.Argument, s)
+		return completion{kind: returnCompletion, value: v}, err
+	case *ast.ThrowStatement:
+		v, err := e.eval(st.Argument, s)
+		if err != nil {
+			return completion{}, err
+		}
+		return completion{}, &jsThrow{value: v}
+	default:
+		return completion{}, fmt.Errorf("%T is not modeled", stmt)
+	}
+}
+
+func (e *evaluator) execFor(st *ast.ForStatement, s *evalScope, label string) (completion, error) {
+	s = newEvalScope(s, false)
+	if st.Initializer != nil {
+		switch init := st.Initializer.Initializer.(type) {
+		case *ast.VariableDeclaration:
+			if err := e.declare(init, s); err != nil {
+				return completion{}, err
+			}
+		case *ast.Expression:
+			if _, err := e.eval(init, s); err != nil {
+				return completion{}, err
+			}
+		}
+	}
+	return e.execLoop(s, label, st.Test, st.Body, st.Update, false)
+}
+
+// execLoop runs a while, do-while or for loop body. A nil test loops forever.
+func (e *evaluator) execLoop(s *evalScope, label string, test *ast.Expression, body *ast.Statement, update *ast.Expression, bodyFirst bool) (completion, error) {
+	for first := true; ; first = false {
+		if !(bodyFirst && first) && test != nil && test.Expr != nil {
+			v, err := e.eval(test, s)
+			if err != nil {
+				return completion{}, err
+			}
+			if !truthy(v) {
+				return completion{}, nil
+			}
+		}
+
+		c, err := e.exec(body.Stmt, s, "")
+		if err != nil {
+			return completion{}, err
+		}
+		switch c.kind {
+		case breakCompletion:
+			if c.label == "" {
+				return completion{}, nil
+			}
+			return c, nil
+		case continueCompletion:
+			if c.label != "" && c.label != label {
+				return c, nil
+			}
+		case returnCompletion:
+			return c, nil
+		}
+
+		if update != nil && update.Expr != nil {
+			if _, err := e.eval(update, s); err != nil {
+				return completion{}, err
+			}
+		}
+	}
+}
+
+func (e *evaluator) execTry(st *ast.TryStatement, s *evalScope) (completion, error) {
+	c, err := e.execStatements(st.Body.List, newEvalScope(s, false))
+	if thrown, ok := err.(*jsThrow); ok && st.Catch != nil {
+		e.lastCaught = thrown
+		cs := newEvalScope(s, false)
+		if st.Catch.Parameter != nil {
+			id, ok := st.Catch.Parameter.Target.(*ast.Identifier)
+			if !ok {
+				return completion{}, fmt.Errorf("destructuring catch parameters are not modeled")
+			}
+			cs.vars[id.Name] = thrown.value
+		}
+		c, err = e.execStatements(st.Catch.Body.List, cs)
+	}
+	if st.Finally != nil {
+		fc, ferr := e.execStatements(st.Finally.List, newEvalScope(s, false))
+		if ferr != nil || fc.kind != normalCompletion {
+			return fc, ferr
+		}
+	}
+	return c, err
+}
+
+func (e *evaluator) declare(decl *ast.VariableDeclaration, s *evalScope) error {
+	for _, d := range decl.List {
+		id, ok := d.Target.Target.(*ast.Identifier)
+		if !ok {
+			return fmt.Errorf("destructuring declarations are not modeled")
+		}
+		var v any = undefined
+		if d.Initializer != nil {
+			var err error
+			if v, err = e.eval(d.Initializer, s); err != nil {
+				return err
+			}
+		} else if decl.Token == token.Var {
+			// `var x;` keeps the hoisted value.
+			continue
+		}
+		if decl.Token == token.Var {
+			s.functionScope().vars[id.Name] = v
+		} else {
+			s.vars[id.Name] = v
+		}
+	}
+	return nil
+}
+
+func (e *evaluator) evalArgs(list ast.Expressions, s *evalScope) ([]any, error) {
+	args := make([]any, len(list))
+	for i := range list {
+		if _, ok := list[i].Expr.(*ast.SpreadElement); ok {
+			return nil, fmt.Errorf("spread arguments are not modeled")
+		}
+		v, err := e.eval(&list[i], s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func (e *evaluator) eval(expr *ast.Expression, s *evalScope) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+
+	switch n := expr.Expr.(type) {
+	case *ast.NumberLiteral:
+		return n.Value, nil
+	case *ast.StringLiteral:
+		return n.Value, nil
+	case *ast.BooleanLiteral:
+		return n.Value, nil
+	case *ast.NullLiteral:
+		return jsNull{}, nil
+	case *ast.ThisExpression:
+		return undefined, nil
+	case *ast.Identifier:
+		return e.lookup(n.Name, s)
+	case *ast.ArrayLiteral:
+		arr := &jsArray{elems: make([]any, len(n.Value))}
+		for i := range n.Value {
+			if n.Value[i].Expr == nil {
+				arr.elems[i] = undefined
+				continue
+			}
+			if _, ok := n.Value[i].Expr.(*ast.SpreadElement); ok {
+				return nil, fmt.Errorf("spread elements are not modeled")
+			}
+			v, err := e.eval(&n.Value[i], s)
+			if err != nil {
+				return nil, err
+			}
+			arr.elems[i] = v
+		}
+		return arr, nil
+	case *ast.ObjectLiteral:
+		return e.evalObject(n, s)
+	case *ast.FunctionLiteral:
+		return e.closure(n, s), nil
+	case *ast.SequenceExpression:
+		var v any = undefined
+		for i := range n.Sequence {
+			var err error
+			if v, err = e.eval(&n.Sequence[i], s); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case *ast.ConditionalExpression:
+		test, err := e.eval(n.Test, s)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(test) {
+			return e.eval(n.Consequent, s)
+		}
+		return e.eval(n.Alternate, s)
+	case *ast.UnaryExpression:
+		return e.evalUnary(n, s)
+	case *ast.BinaryExpression:
+		return e.evalBinary(n, s)
+	case *ast.AssignExpression:
+		return e.evalAssign(n, s)
+	case *ast.UpdateExpression:
+		return e.evalUpdate(n, s)
+	case *ast.MemberExpression:
+		obj, key, err := e.evalMemberRef(n, s)
+		if err != nil {
+			return nil, err
+		}
+		return getMember(obj, key)
+	case *ast.CallExpression:
+		return e.evalCall(n, s)
+	default:
+		return nil, fmt.Errorf("%T is not modeled", expr.Expr)
+	}
+}
+
+func (e *evaluator) lookup(name string, s *evalScope) (any, error) {
+	if scope, ok := s.lookup(name); ok {
+		return scope.vars[name], nil
+	}
+	switch name {
+	case "undefined":
+		return undefined, nil
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	}
+	// A browser would throw a catchable ReferenceError here, which the rotation loop would
+	// swallow forever; a global we do not model is a reason to stop instead.
+	return nil, fmt.Errorf("code reads %s, which the evaluator does not model", name)
+}
+
+func (e *evaluator) evalObject(n *ast.ObjectLiteral, s *evalScope) (any, error) {
+	obj := &jsObject{props: make(map[string]any)}
+	for _, entry := range n.Value {
+		prop, ok := entry.Prop.(*ast.PropertyKeyed)
+		if !ok || prop.Kind != ast.PropertyKindValue {
+			return nil, fmt.Errorf("%T object properties are not modeled", entry.Prop)
+		}
+		var key string
+		if prop.Computed {
+			k, err := e.eval(prop.Key, s)
+			if err != nil {
+				return nil, err
+			}
+			key = toJSString(k)
+		} else if num, ok := prop.Key.Expr.(*ast.NumberLiteral); ok {
+			key = toJSString(num.Value)
+		} else if key, ok = literalKeyName(prop.Key); !ok {
+			return nil, fmt.Errorf("object key %T is not modeled", prop.Key.Expr)
+		}
+		v, err := e.eval(prop.Value, s)
+		if err != nil {
+			return nil, err
+		}
+		obj.props[key] = v
+	}
+	return obj, nil
+}
+
+func (e *evaluator) evalMemberRef(n *ast.MemberExpression, s *evalScope) (any, string, error) {
+	obj, err := e.eval(n.Object, s)
+	if err != nil {
+		return nil, "", err
+	}
+	switch prop := n.Property.Prop.(type) {
+	case *ast.Identifier:
+		return obj, prop.Name, nil
+	case *ast.ComputedProperty:
+		k, err := e.eval(prop.Expr, s)
+		if err != nil {
+			return nil, "", err
+		}
+		return obj, toJSString(k), nil
+	default:
+		return nil, "", fmt.Errorf("%T members are not modeled", n.Property.Prop)
+	}
+}
+
+func (e *evaluator) evalCall(n *ast.CallExpression, s *evalScope) (any, error) {
+	var callee any
+	var err error
+	var name string
+	if member, ok := n.Callee.Expr.(*ast.MemberExpression); ok {
+		var obj any
+		if obj, name, err = e.evalMemberRef(member, s); err != nil {
+			return nil, err
+		}
+		callee, err = getMember(obj, name)
+	} else {
+		if id, ok := n.Callee.Expr.(*ast.Identifier); ok {
+			name = id.Name
+		}
+		callee, err = e.eval(n.Callee, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := e.evalArgs(n.ArgumentList, s)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := callee.(*jsFunction)
+	if !ok {
+		return nil, typeError("%s is not a function", name)
+	}
+	return e.callFunction(fn, args)
+}
+
+func (e *evaluator) evalAssign(n *ast.AssignExpression, s *evalScope) (any, error) {
+	op := n.Operator.String()
+	switch target := n.Left.Expr.(type) {
+	case *ast.Identifier:
+		scope, ok := s.lookup(target.Name)
+		if !ok {
+			if op != "=" {
+				return nil, fmt.Errorf("code reads %s, which the evaluator does not model", target.Name)
+			}
+			// Sloppy-mode scripts create a global on assignment to an undeclared name.
+			scope = s.global()
+		}
+		v, err := e.eval(n.Right, s)
+		if err != nil {
+			return nil, err
+		}
+		if op != "=" {
+			if v, err = binaryOp(strings.TrimSuffix(op, "="), scope.vars[target.Name], v); err != nil {
+				return nil, err
+			}
+		}
+		scope.vars[target.Name] = v
+		return v, nil
+	case *ast.MemberExpression:
+		obj, key, err := e.evalMemberRef(target, s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.eval(n.Right, s)
+		if err != nil {
+			return nil, err
+		}
+		if op != "=" {
+			old, err := getMember(obj, key)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = binaryOp(strings.TrimSuffix(op, "="), old, v); err != nil {
+				return nil, err
+			}
+		}
+		return v, setMember(obj, key, v)
+	default:
+		return nil, fmt.Errorf("assignment to %T is not modeled", n.Left.Expr)
+	}
+}
+
+func (e *evaluator) evalUpdate(n *ast.UpdateExpression, s *evalScope) (any, error) {
+	delta := 1.0
+	if n.Operator.String() == "--" {
+		delta = -1
+	}
+
+	var old float64
+	var set func(float64) error
+	switch target := n.Operand.Expr.(type) {
+	case *ast.Identifier:
+		scope, ok := s.lookup(target.Name)
+		if !ok {
+			return nil, fmt.Errorf("code reads %s, which the evaluator does not model", target.Name)
+		}
+		old = toJSNumber(scope.vars[target.Name])
+		set = func(v float64) error {
+			scope.vars[target.Name] = v
+			return nil
+		}
+	case *ast.MemberExpression:
+		obj, key, err := e.evalMemberRef(target, s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := getMember(obj, key)
+		if err != nil {
+			return nil, err
+		}
+		old = toJSNumber(v)
+		set = func(v float64) error { return setMember(obj, key, v) }
+	default:
+		return nil, fmt.Errorf("update of %T is not modeled", n.Operand.Expr)
+	}
+
+	if err := set(old + delta); err != nil {
+		return nil, err
+	}
+	if n.Postfix {
+		return old, nil
+	}
+	return old + delta, nil
+}
+
+func (e *evaluator) evalUnary(n *ast.UnaryExpression, s *evalScope) (any, error) {
+	op := n.Operator.String()
+	if op == "typeof" {
+		if id, ok := n.Operand.Expr.(*ast.Identifier); ok {
+			if _, declared := s.lookup(id.Name); !declared {
+				return "undefined", nil
+			}
+		}
+	}
+
+	v, err := e.eval(n.Operand, s)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "!":
+		return !truthy(v), nil
+	case "-":
+		return -toJSNumber(v), nil
+	case "+":
+		return toJSNumber(v), nil
+	case "~":
+		return float64(^jsnum.ToInt32(toJSNumber(v))), nil
+	case "void":
+		return undefined, nil
+	case "typeof":
+		return jsTypeOf(v), nil
+	default:
+		return nil, fmt.Errorf("unary %s is not modeled", op)
+	}
+}
+
+func (e *evaluator) evalBinary(n *ast.BinaryExpression, s *evalScope) (any, error) {
+	l, err := e.eval(n.Left, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := n.Operator.String(); op {
+	case "&&":
+		if !truthy(l) {
+			return l, nil
+		}
+		return e.eval(n.Right, s)
+	case "||":
+		if truthy(l) {
+			return l, nil
+		}
+		return e.eval(n.Right, s)
+	case "??":
+		switch l.(type) {
+		case jsUndefined, jsNull:
+			return e.eval(n.Right, s)
+		}
+		return l, nil
+	default:
+		r, err := e.eval(n.Right, s)
+		if err != nil {
+			return nil, err
+		}
+		return binaryOp(op, l, r)
+	}
+}
+
+// binaryOp applies a non-short-circuiting binary operator with JavaScript coercions.
+func binaryOp(op string, l, r any) (any, error) {
+	switch op {
+	case "+":
+		lp, rp := toPrimitive(l), toPrimitive(r)
+		_, ls := lp.(string)
+		_, rs := rp.(string)
+		if ls || rs {
+			return toJSString(lp) + toJSString(rp), nil
+		}
+		return toJSNumber(lp) + toJSNumber(rp), nil
+	case "-":
+		return toJSNumber(l) - toJSNumber(r), nil
+	case "*":
+		return toJSNumber(l) * toJSNumber(r), nil
+	case "/":
+		return toJSNumber(l) / toJSNumber(r), nil
+	case "%":
+		return math.Mod(toJSNumber(l), toJSNumber(r)), nil
+	case "**":
+		x, y := toJSNumber(l), toJSNumber(r)
+		if math.IsNaN(y) || (math.Abs(x) == 1 && math.IsInf(y, 0)) {
+			return math.NaN(), nil
+		}
+		return math.Pow(x, y), nil
+	case "&":
+		return float64(jsnum.ToInt32(toJSNumber(l)) & jsnum.ToInt32(toJSNumber(r))), nil
+	case "|":
+		return float64(jsnum.ToInt32(toJSNumber(l)) | jsnum.ToInt32(toJSNumber(r))), nil
+	case "^":
+		return float64(jsnum.ToInt32(toJSNumber(l)) ^ jsnum.ToInt32(toJSNumber(r))), nil
+	case "<<":
+		return float64(jsnum.ToInt32(toJSNumber(l)) << (jsnum.ToUint32(toJSNumber(r)) & 31)), nil
+	case ">>":
+		return float64(jsnum.ToInt32(toJSNumber(l)) >> (jsnum.ToUint32(toJSNumber(r)) & 31)), nil
+	case ">>>":
+		return float64(jsnum.ToUint32(toJSNumber(l)) >> (jsnum.ToUint32(toJSNumber(r)) & 31)), nil
+	case "===":
+		return strictEquals(l, r), nil
+	case "!==":
+		return !strictEquals(l, r), nil
+	case "==":
+		return looseEquals(l, r), nil
+	case "!=":
+		return !looseEquals(l, r), nil
+	case "<":
+		lt, ok := lessThan(l, r)
+		return ok && lt, nil
+	case ">":
+		lt, ok := lessThan(r, l)
+		return ok && lt, nil
+	case "<=":
+		lt, ok := lessThan(r, l)
+		return ok && !lt, nil
+	case ">=":
+		lt, ok := lessThan(l, r)
+		return ok && !lt, nil
+	default:
+		return nil, fmt.Errorf("binary %s is not modeled", op)
+	}
+}
+
+func getMember(obj any, key string) (any, error) {
+	switch o := obj.(type) {
+	case jsUndefined, jsNull:
+		return nil, typeError("Cannot read properties of %s (reading '%s')", toJSString(o), key)
+	case *jsObject:
+		if v, ok := o.props[key]; ok {
+			return v, nil
+		}
+		return undefined, nil
+	case *jsArray:
+		if key == "length" {
+			return float64(len(o.elems)), nil
+		}
+		if idx, ok := arrayIndex(key); ok {
+			if idx < len(o.elems) {
+				return o.elems[idx], nil
+			}
+			return undefined, nil
+		}
+		if method := arrayMethod(o, key); method != nil {
+			return method, nil
+		}
+		return nil, fmt.Errorf("array property %s is not modeled", key)
+	case string:
+		units := utf16.Encode([]rune(o))
+		if key == "length" {
+			return float64(len(units)), nil
+		}
+		if idx, ok := arrayIndex(key); ok {
+			if idx < len(units) {
+				return string(utf16.Decode(units[idx : idx+1])), nil
+			}
+			return undefined, nil
+		}
+		if method := stringMethod(units, key); method != nil {
+			return method, nil
+		}
+		return nil, fmt.Errorf("string property %s is not modeled", key)
+	default:
+		return nil, fmt.Errorf("properties of %s values are not modeled", jsTypeOf(obj))
+	}
+}
+
+func setMember(obj any, key string, v any) error {
+	switch o := obj.(type) {
+	case jsUndefined, jsNull:
+		return typeError("Cannot set properties of %s (setting '%s')", toJSString(o), key)
+	case *jsObject:
+		o.props[key] = v
+		return nil
+	case *jsArray:
+		if idx, ok := arrayIndex(key); ok {
+			for len(o.elems) <= idx {
+				o.elems = append(o.elems, undefined)
+			}
+			o.elems[idx] = v
+			return nil
+		}
+		return fmt.Errorf("setting array property %s is not modeled", key)
+	default:
+		return fmt.Errorf("setting properties of %s values is not modeled", jsTypeOf(obj))
+	}
+}
+
+// arrayIndex parses a canonical array index small enough to index a Go slice.
+func arrayIndex(key string) (int, bool) {
+	if !isCanonicalIndex(key) {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(key)
+	return idx, err == nil && idx < 1<<24
+}
+
+func isCanonicalIndex(key string) bool {
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '0' || key[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayMethod(a *jsArray, name string) *jsFunction {
+	var native func(args []any) (any, error)
+	switch name {
+	case "push":
+		native = func(args []any) (any, error) {
+			a.elems = append(a.elems, args...)
+			return float64(len(a.elems)), nil
+		}
+	case "pop":
+		native = func([]any) (any, error) {
+			if len(a.elems) == 0 {
+				return undefined, nil
+			}
+			v := a.elems[len(a.elems)-1]
+			a.elems = a.elems[:len(a.elems)-1]
+			return v, nil
+		}
+	case "shift":
+		native = func([]any) (any, error) {
+			if len(a.elems) == 0 {
+				return undefined, nil
+			}
+			v := a.elems[0]
+			a.elems = append(a.elems[:0:0], a.elems[1:]...)
+			return v, nil
+		}
+	case "unshift":
+		native = func(args []any) (any, error) {
+			a.elems = append(append(make([]any, 0, len(args)+len(a.elems)), args...), a.elems...)
+			return float64(len(a.elems)), nil
+		}
+	default:
+		return nil
+	}
+	return &jsFunction{native: native}
+}
+
+func stringMethod(units []uint16, name string) *jsFunction {
+	// position reads an integer argument the way ToIntegerOrInfinity does.
+	position := func(args []any, i int) float64 {
+		if i >= len(args) {
+			return 0
+		}
+		f := toJSNumber(args[i])
+		if math.IsNaN(f) {
+			return 0
+		}
+		return math.Trunc(f)
+	}
+
+	var native func(args []any) (any, error)
+	switch name {
+	case "charAt":
+		native = func(args []any) (any, error) {
+			if i := position(args, 0); i >= 0 && i < float64(len(units)) {
+				return string(utf16.Decode(units[int(i) : int(i)+1])), nil
+			}
+			return "", nil
+		}
+	case "charCodeAt":
+		native = func(args []any) (any, error) {
+			if i := position(args, 0); i >= 0 && i < float64(len(units)) {
+				return float64(units[int(i)]), nil
+			}
+			return math.NaN(), nil
+		}
+	case "indexOf":
+		native = func(args []any) (any, error) {
+			var search []uint16
+			if len(args) > 0 {
+				search = utf16.Encode([]rune(toJSString(args[0])))
+			} else {
+				search = utf16.Encode([]rune("undefined"))
+			}
+			from := int(min(max(position(args, 1), 0), float64(len(units))))
+			for i := from; i+len(search) <= len(units); i++ {
+				if slices.Equal(units[i:i+len(search)], search) {
+					return float64(i), nil
+				}
+			}
+			return -1.0, nil
+		}
+	case "split":
+		native = func(args []any) (any, error) {
+			if len(args) > 1 {
+				if _, ok := args[1].(jsUndefined); !ok {
+					return nil, fmt.Errorf("split with a limit is not modeled")
+				}
+			}
+			s := string(utf16.Decode(units))
+			var parts []string
+			if len(args) == 0 || args[0] == undefined {
+				parts = []string{s}
+			} else if sep := toJSString(args[0]); sep == "" {
+				for _, u := range units {
+					parts = append(parts, string(utf16.Decode([]uint16{u})))
+				}
+			} else {
+				parts = strings.Split(s, sep)
+			}
+			arr := &jsArray{elems: make([]any, len(parts))}
+			for i, part := range parts {
+				arr.elems[i] = part
+			}
+			return arr, nil
+		}
+	default:
+		return nil
+	}
+	return &jsFunction{native: native}
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case jsUndefined, jsNull:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0 && !math.IsNaN(x)
+	case string:
+		return x != ""
+	default:
+		return true
+	}
+}
+
+func jsTypeOf(v any) string {
+	switch v.(type) {
+	case jsUndefined:
+		return "undefined"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *jsFunction:
+		return "function"
+	default:
+		return "object"
+	}
+}
+
+// toPrimitive converts arrays and objects the way their default toString would.
+func toPrimitive(v any) any {
+	switch x := v.(type) {
+	case *jsArray:
+		parts := make([]string, len(x.elems))
+		for i, elem := range x.elems {
+			switch elem.(type) {
+			case jsUndefined, jsNull:
+			default:
+				parts[i] = toJSString(elem)
+			}
+		}
+		return strings.Join(parts, ",")
+	case *jsObject:
+		return "[object Object]"
+	case *jsFunction:
+		return "function () { [native code] }"
+	default:
+		return v
+	}
+}
+
+func toJSString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return jsnum.ToString(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case jsUndefined:
+		return "undefined"
+	case jsNull:
+		return "null"
+	default:
+		return toJSString(toPrimitive(v))
+	}
+}
+
+func toJSNumber(v any) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case bool:
+		if x {
+			return 1
+		}
+		return 0
+	case jsUndefined:
+		return math.NaN()
+	case jsNull:
+		return 0
+	case string:
+		return jsnum.ToNumber(x)
+	default:
+		return toJSNumber(toPrimitive(v))
+	}
+}
+
+func strictEquals(l, r any) bool {
+	switch x := l.(type) {
+	case float64:
+		y, ok := r.(float64)
+		return ok && x == y
+	case string:
+		y, ok := r.(string)
+		return ok && x == y
+	case bool:
+		y, ok := r.(bool)
+		return ok && x == y
+	default:
+		return l == r
+	}
+}
+
+func looseEquals(l, r any) bool {
+	if jsTypeOf(l) == jsTypeOf(r) {
+		return strictEquals(l, r)
+	}
+	isNullish := func(v any) bool {
+		switch v.(type) {
+		case jsUndefined, jsNull:
+			return true
+		}
+		return false
+	}
+	if isNullish(l) || isNullish(r) {
+		return isNullish(l) && isNullish(r)
+	}
+
+	switch l.(type) {
+	case bool:
+		return looseEquals(toJSNumber(l), r)
+	case *jsArray, *jsObject, *jsFunction:
+		return looseEquals(toPrimitive(l), r)
+	}
+	switch r.(type) {
+	case bool:
+		return looseEquals(l, toJSNumber(r))
+	case *jsArray, *jsObject, *jsFunction:
+		return looseEquals(l, toPrimitive(r))
+	}
+	// One side is a number and the other a string.
+	return toJSNumber(l) == toJSNumber(r)
+}
+
+// lessThan is the abstract relational comparison l < r. ok is false when either side is NaN,
+// which makes every relational operator false.
+func lessThan(l, r any) (lt, ok bool) {
+	lp, rp := toPrimitive(l), toPrimitive(r)
+	if ls, isStr := lp.(string); isStr {
+		if rs, isStr := rp.(string); isStr {
+			return lessUTF16(ls, rs), true
+		}
+	}
+	x, y := toJSNumber(lp), toJSNumber(rp)
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return false, false
+	}
+	return x < y, true
+}
+
+// lessUTF16 compares strings by UTF-16 code units like JavaScript does.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
@@ -0,0 +1,231 @@
+package visitors
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/t14raptor/go-fast/ast"
+	fastgen "github.com/t14raptor/go-fast/generator"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// FunctionShape describes one function of a deobfuscated program, for lining up the functions of
+// two versions of a script.
+type FunctionShape struct {
+	// Name is the function's own name, or the variable or property it is assigned to.
+	Name     string   `json:"name,omitempty"`
+	Position Position `json:"position"`
+	Params   int      `json:"params"`
+	// Shape hashes the structure of the function the way ScriptSignature hashes a script.
+	// Content also covers its literal values and the globals and properties it reads, but not
+	// the names of its own bindings. Nested functions count as one node in both, so a change
+	// inside one only shows on the nested function. The string-table functions and decoders
+	// of the obfuscator, whose changes show in their tables, have a Content equal to Shape.
+	Shape   string `json:"shape"`
+	Content string `json:"content"`
+	// Preview is the first line of the function's code.
+	Preview string `json:"preview"`
+}
+
+// FunctionShapes returns every function of p in source order. src is the script p was parsed
+// from, for positions.
+func FunctionShapes(p *ast.Program, src *SourceFile) []FunctionShape {
+	names := functionNames(p)
+	content := newContentLabeler(p)
+
+	var shapes []FunctionShape
+	for _, m := range astmatch.FindAll(p, astmatch.AnyOf(astmatch.Is[*ast.FunctionLiteral](), astmatch.Is[*ast.ArrowFunctionLiteral]())) {
+		fn := m.Node
+		leaf := func(n ast.VisitableNode) bool { return n != fn && isFunctionNode(n) }
+		shape := shapeHasher{label: shapeLabel, leaf: leaf}.hash(fn)
+		full := shape
+		if lit, ok := fn.(*ast.FunctionLiteral); !ok || !reassignsItself(lit) {
+			full = shapeHasher{label: content.label, leaf: leaf}.hash(fn)
+		}
+
+		s := FunctionShape{
+			Name:    names[fn],
+			Shape:   hex.EncodeToString(shape[:8]),
+			Content: hex.EncodeToString(full[:8]),
+			Preview: previewLine(fastgen.Generate(fn)),
+		}
+		s.Position, _ = src.positionOf(fn)
+		switch fn := fn.(type) {
+		case *ast.FunctionLiteral:
+			s.Params = len(fn.ParameterList.List)
+			if fn.Name != nil {
+				s.Name = fn.Name.Name
+			}
+		case *ast.ArrowFunctionLiteral:
+			s.Params = len(fn.ParameterList.List)
+		}
+		shapes = append(shapes, s)
+	}
+	return shapes
+}
+
+func isFunctionNode(n ast.VisitableNode) bool {
+	switch n.(type) {
+	case *ast.FunctionLiteral, *ast.ArrowFunctionLiteral:
+		return true
+	}
+	return false
+}
+
+var functionValue = astmatch.Capture("fn", astmatch.AnyOf(astmatch.Is[*ast.FunctionLiteral](), astmatch.Is[*ast.ArrowFunctionLiteral]()))
+
+// functionNames maps anonymous functions to the variable, member or property they are stored in.
+func functionNames(p *ast.Program) map[ast.VisitableNode]string {
+	names := make(map[ast.VisitableNode]string)
+	for _, m := range astmatch.FindAll(p, astmatch.AnyOf(
+		astmatch.Declarator(astmatch.Capture("name", astmatch.Ident()), functionValue),
+		astmatch.Assign("=", astmatch.Capture("name", astmatch.AnyOf(astmatch.Ident(), astmatch.Is[*ast.MemberExpression]())), functionValue),
+	)) {
+		fn := astmatch.Unwrap(m.Captures["fn"]).(ast.VisitableNode)
+		switch target := astmatch.Unwrap(m.Captures["name"]).(type) {
+		case *ast.Identifier:
+			names[fn] = target.Name
+		case *ast.MemberExpression:
+			if name, ok := memberPropName(target.Property); ok {
+				names[fn] = name
+			}
+		}
+	}
+	for _, m := range astmatch.FindAll(p, astmatch.Is[*ast.PropertyKeyed]()) {
+		prop := m.Node.(*ast.PropertyKeyed)
+		if _, ok := astmatch.Matches(prop.Value, functionValue); !ok {
+			continue
+		}
+		if name, ok := literalKeyName(prop.Key); ok {
+			names[astmatch.Unwrap(prop.Value).(ast.VisitableNode)] = name
+		}
+	}
+	return names
+}
+
+// previewLine returns the first line of code, cut to a readable length.
+func previewLine(code string) string {
+	if i := strings.IndexByte(code, '\n'); i >= 0 {
+		code = code[:i]
+	}
+	if r := []rune(code); len(r) > 80 {
+		code = string(r[:77]) + "..."
+	}
+	return strings.TrimSpace(code)
+}
+
+// contentLabeler labels nodes for FunctionShape.Content: the shape label plus the value of
+// literals and the name of identifiers that are not bound anywhere in the program, which are the
+// globals the script reads and the properties it accesses.
+type contentLabeler struct {
+	declared   map[string]struct{}
+	properties map[*ast.Identifier]struct{}
+}
+
+func newContentLabeler(p *ast.Program) *contentLabeler {
+	c := &contentLabeler{
+		declared:   make(map[string]struct{}),
+		properties: make(map[*ast.Identifier]struct{}),
+	}
+	astmatch.Walk(p, func(n ast.VisitableNode) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			if n.Name != nil {
+				c.declared[n.Name.Name] = struct{}{}
+			}
+		case *ast.BindingTarget:
+			if id, ok := n.Target.(*ast.Identifier); ok {
+				c.declared[id.Name] = struct{}{}
+			}
+		case *ast.ParameterList:
+			if id, ok := n.Rest.(*ast.Identifier); ok {
+				c.declared[id.Name] = struct{}{}
+			}
+		case *ast.MemberProperty:
+			if id, ok := n.Prop.(*ast.Identifier); ok {
+				c.properties[id] = struct{}{}
+			}
+		}
+		return true
+	})
+	return c
+}
+
+func (c *contentLabeler) label(n ast.VisitableNode) string {
+	label := shapeLabel(n)
+	switch n := n.(type) {
+	case *ast.StringLiteral:
+		label += strconv.Quote(n.Value)
+	case *ast.NumberLiteral:
+		label += formatJSNumber(n.Value)
+	case *ast.BooleanLiteral:
+		label += strconv.FormatBool(n.Value)
+	case *ast.RegExpLiteral:
+		label += "/" + n.Pattern + "/" + n.Flags
+	case *ast.Identifier:
+		_, property := c.properties[n]
+		if _, bound := c.declared[n.Name]; property || !bound {
+			label += " " + n.Name
+		}
+	}
+	return label
+}
+
+// StringList is a list of string literals in a program, such as the names of the properties a
+// script probes.
+type StringList struct {
+	Position Position `json:"position"`
+	Values   []string `json:"values"`
+}
+
+// stringListSplit matches a list written as a split string literal, `'a|b|c'.split('|')`.
+var stringListSplit = astmatch.Call(
+	astmatch.Member(astmatch.Capture("list", astmatch.Str()), astmatch.Prop("split")),
+	astmatch.Capture("sep", astmatch.Str()),
+)
+
+// StringLists returns the lists of two or more strings in p, written as arrays of string
+// literals or as split string literals. Lists inside functions that reassign themselves, the
+// string tables and decoders of the obfuscator, are left out.
+func StringLists(p *ast.Program, src *SourceFile) []StringList {
+	var lists []StringList
+	astmatch.Walk(p, func(n ast.VisitableNode) bool {
+		if astmatch.Unwrap(n) != any(n) {
+			// Wrappers are matched through the node they hold.
+			return true
+		}
+		if fn, ok := n.(*ast.FunctionLiteral); ok && reassignsItself(fn) {
+			return false
+		}
+
+		var values []string
+		if c, ok := astmatch.Matches(n, stringListSplit); ok {
+			list, _ := astmatch.Get[*ast.StringLiteral](c, "list")
+			sep, _ := astmatch.Get[*ast.StringLiteral](c, "sep")
+			values = strings.Split(list.Value, sep.Value)
+		} else if _, ok := astmatch.Matches(n, stringTableArray); ok {
+			for _, v := range n.(*ast.ArrayLiteral).Value {
+				values = append(values, v.Expr.(*ast.StringLiteral).Value)
+			}
+		}
+		if len(values) < 2 {
+			return true
+		}
+		pos, _ := src.positionOf(n)
+		lists = append(lists, StringList{Position: pos, Values: values})
+		return false
+	})
+	return lists
+}
+
+// reassignsItself reports whether fn is a named function that assigns a new function to its own
+// name, like the string-table functions and decoders of the obfuscator.
+func reassignsItself(fn *ast.FunctionLiteral) bool {
+	if fn.Name == nil || fn.Body == nil {
+		return false
+	}
+	_, ok := astmatch.Matches(fn.Body, astmatch.Contains(astmatch.Assign("=", astmatch.Ident(fn.Name.Name), astmatch.Is[*ast.FunctionLiteral]())))
+	return ok
+}
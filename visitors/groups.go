@@ -0,0 +1,220 @@
+package visitors
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// stringGroup is one string-array module: a decoder, the string-table function it reads, the
+// IIFE that rotates the table and the aliases the module calls the decoder through. Bundles of
+// several obfuscated modules have one group each, and a group only resolves calls inside the
+// statement list that declares its decoder.
+type stringGroup struct {
+	// root is the Program or block whose statements, body, declare the decoder.
+	root ast.VisitableNode
+	body ast.Statements
+	src  *SourceFile
+	work *workBudget
+
+	decoder   string
+	decl      *ast.FunctionLiteral
+	tableFn   string
+	table     []string
+	offset    int
+	target    int
+	aliases   map[string]struct{}
+	encoding  *stringEncoding
+	strings   map[float64]string
+	wrappers  map[string]*decoderWrapper
+	extraArgs bool
+	// engine is the engine fallback of the group, when it ran.
+	engine *jsEngine
+}
+
+// findStringGroups returns a group for every decoder in the program, outer scopes first. A
+// decoder is a function declaration that reassigns itself to a function literal and shifts its
+// index by the offset.
+func findStringGroups(p *ast.Program, src *SourceFile, work *workBudget) []*stringGroup {
+	var groups []*stringGroup
+	for _, m := range astmatch.FindAll(p, astmatch.AnyOf(astmatch.Is[*ast.Program](), astmatch.Is[*ast.BlockStatement]())) {
+		var body ast.Statements
+		switch n := m.Node.(type) {
+		case *ast.Program:
+			body = n.Body
+		case *ast.BlockStatement:
+			body = n.List
+		}
+		for _, stmt := range body {
+			decl, ok := stmt.Stmt.(*ast.FunctionDeclaration)
+			if !ok || !isDecoder(decl.Function) {
+				continue
+			}
+			groups = append(groups, &stringGroup{
+				root:    m.Node,
+				body:    body,
+				src:     src,
+				work:    work,
+				decoder: decl.Function.Name.Name,
+				decl:    decl.Function,
+			})
+		}
+	}
+	return groups
+}
+
+func isDecoder(fn *ast.FunctionLiteral) bool {
+	if fn == nil || !reassignsItself(fn) {
+		return false
+	}
+	_, ok := astmatch.Matches(fn.Body, astmatch.Contains(offsetShift))
+	return ok
+}
+
+// noDecoderError explains why a program has no string group, with the step the single-decoder
+// pipeline used to stop at.
+func noDecoderError(p *ast.Program) error {
+	if _, ok := astmatch.FindFirst(p, offsetShift); !ok {
+		return fmt.Errorf("failed at step 1: could not extract decoder offset")
+	}
+	return fmt.Errorf("failed at step 4: failed to detect decoder function (no self-reassigning function with offset subtraction found)")
+}
+
+// extractStrings statically builds the group's rotated string table (steps 1 to 5). The
+// aliases are kept once step 4 has collected them. Entries of base64 tables come back decoded;
+// entries of keyed tables stay as they are and the group keeps their encoding.
+func (g *stringGroup) extractStrings(opts Options) error {
+	for _, pattern := range []astmatch.Pattern{decoderOffsetAssign, offsetShift} {
+		if m, ok := astmatch.FindFirst(g.decl, pattern); ok {
+			n, _ := astmatch.Get[*ast.NumberLiteral](m.Captures, "offset")
+			g.offset = int(n.Value)
+			break
+		}
+	}
+	if g.offset == 0 {
+		return fmt.Errorf("failed at step 1: could not extract decoder offset")
+	}
+
+	g.findTable()
+	tableArg := astmatch.Ident()
+	if g.tableFn != "" {
+		tableArg = astmatch.Ident(g.tableFn)
+	}
+	m, ok := astmatch.FindFirst(g.root, astmatch.Call(astmatch.Any(), tableArg, rotationTarget))
+	if !ok {
+		return fmt.Errorf("failed at step 2: could not extract rotation target")
+	}
+	target, _ := astmatch.Get[*ast.NumberLiteral](m.Captures, "target")
+	g.target = int(target.Value)
+
+	// The checksum normally sits in the rotation function itself; a rotation function declared
+	// elsewhere is found by searching the whole scope.
+	checksum, ok := astmatch.FindFirst(m.Node.(*ast.CallExpression).Callee, rotationChecksum)
+	if !ok {
+		checksum, ok = astmatch.FindFirst(g.root, rotationChecksum)
+	}
+	if !ok {
+		return fmt.Errorf("failed at step 3: could not extract rotation expression")
+	}
+	rotationExpr := *checksum.Captures["expr"].(*ast.Expression)
+
+	g.collectAliases()
+
+	encoding, err := detectStringEncoding(g.decl)
+	if err != nil {
+		return fmt.Errorf("failed at step 5: %w", err)
+	}
+	strings, err := buildstringsDynamic(g, g.target, rotationExpr, encoding, opts.RotationStepBudget)
+	if err != nil {
+		return fmt.Errorf("failed at step 5: %w", err)
+	}
+	g.strings = strings
+	if encoding.keyed() {
+		g.encoding = encoding
+	}
+	return nil
+}
+
+// findTable sets the string-table function: a function declaration next to the decoder that
+// holds a table literal and that the decoder calls. When the decoder calls none of them, the
+// longest table in the scope is used.
+func (g *stringGroup) findTable() {
+	var longestFn string
+	var longest []string
+	for _, stmt := range g.body {
+		decl, ok := stmt.Stmt.(*ast.FunctionDeclaration)
+		if !ok || decl.Function == g.decl || decl.Function.Name == nil || decl.Function.Body == nil {
+			continue
+		}
+		table := longestStringTable(decl.Function.Body)
+		if table == nil {
+			continue
+		}
+		name := decl.Function.Name.Name
+		if _, called := astmatch.FindFirst(g.decl, astmatch.Call(astmatch.Ident(name), astmatch.Rest())); called {
+			g.tableFn, g.table = name, table
+			return
+		}
+		if len(table) > len(longest) {
+			longestFn, longest = name, table
+		}
+	}
+	g.tableFn, g.table = longestFn, longest
+}
+
+// collectAliases gathers the names the group's scope binds the decoder to.
+func (g *stringGroup) collectAliases() {
+	if g.aliases != nil {
+		return
+	}
+	g.aliases = map[string]struct{}{g.decoder: {}}
+	collectAliasesFrom(g.root, g.aliases)
+}
+
+// inner returns the function literal the decoder reassigns itself to.
+func (g *stringGroup) inner() *ast.FunctionLiteral {
+	m, ok := astmatch.FindFirst(g.decl.Body, astmatch.Assign("=",
+		astmatch.Ident(g.decoder),
+		astmatch.Capture("fn", astmatch.Where(func(fn *ast.FunctionLiteral) bool { return fn.Body != nil })),
+	))
+	if !ok {
+		return nil
+	}
+	fn, _ := astmatch.Get[*ast.FunctionLiteral](m.Captures, "fn")
+	return fn
+}
+
+// StringTable describes a resolved string table. Names are the ones the script was parsed with.
+type StringTable struct {
+	Decoder  string   `json:"decoder"`
+	Function string   `json:"function"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Offset   int      `json:"offset"`
+	Target   int      `json:"target"`
+	// Entries are the rotated table, Entries[0] being the string at index Offset. Entries of
+	// base64 tables are decoded; entries of keyed tables are not.
+	Entries []string `json:"entries"`
+}
+
+func (g *stringGroup) info() StringTable {
+	t := StringTable{
+		Decoder:  g.decoder,
+		Function: g.tableFn,
+		Offset:   g.offset,
+		Target:   g.target,
+	}
+	for name := range g.aliases {
+		if name != g.decoder {
+			t.Aliases = append(t.Aliases, name)
+		}
+	}
+	slices.Sort(t.Aliases)
+	for _, idx := range slices.Sorted(maps.Keys(g.strings)) {
+		t.Entries = append(t.Entries, g.strings[idx])
+	}
+	return t
+}
@@ -0,0 +1,154 @@
+package visitors
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// Limits bound what deobfuscating a script may cost, for scripts from sources that could be
+// hostile or broken. A zero field is no limit.
+type Limits struct {
+	// MaxScriptBytes caps the size of the script text. DeobfuscateCfWithOptions only sees the
+	// parsed program, so callers check it with CheckScriptSize before parsing.
+	MaxScriptBytes int64
+	// MaxNodes caps the number of nodes in the parsed program.
+	MaxNodes int
+	// MaxSteps caps the work of a run: every statement and expression the rotation evaluator
+	// executes, and every rotation the static rotation search tries, in all string groups
+	// together. The engine fallback is bounded by its own EngineOptions and by Timeout.
+	MaxSteps int
+	// Timeout caps the wall-clock time of a run. The clock is read during the rotation
+	// search and evaluation, by the engine fallback and between the passes over the tree, so a
+	// run can overshoot it by the time of one pass. ValidateOutput and GenerateWithSourceMap
+	// run after DeobfuscateCfWithOptions returns and are not covered.
+	Timeout time.Duration
+}
+
+// DefaultLimits leaves real JSD scripts, some hundred kilobytes and a few hundred thousand
+// steps of rotation, well within bounds.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxScriptBytes: 8 << 20,
+		MaxNodes:       2_000_000,
+		MaxSteps:       1 << 25,
+		Timeout:        30 * time.Second,
+	}
+}
+
+// LimitKind names the resource a LimitError ran out of.
+type LimitKind int
+
+const (
+	LimitScriptSize LimitKind = iota
+	LimitNodes
+	LimitSteps
+	LimitTime
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case LimitScriptSize:
+		return "script size"
+	case LimitNodes:
+		return "node count"
+	case LimitSteps:
+		return "step"
+	case LimitTime:
+		return "time"
+	}
+	return fmt.Sprintf("LimitKind(%d)", int(k))
+}
+
+// LimitError is a script exceeding one of its Limits.
+type LimitError struct {
+	Kind LimitKind
+	// Limit is the bound that was exceeded, in bytes, nodes, steps or, for LimitTime,
+	// nanoseconds.
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case LimitScriptSize:
+		return fmt.Sprintf("script is larger than the limit of %d bytes", e.Limit)
+	case LimitNodes:
+		return fmt.Sprintf("script has more than the limit of %d nodes", e.Limit)
+	case LimitSteps:
+		return fmt.Sprintf("deobfuscation took more than the limit of %d steps", e.Limit)
+	case LimitTime:
+		return fmt.Sprintf("deobfuscation took longer than the limit of %v", time.Duration(e.Limit))
+	}
+	return fmt.Sprintf("%v limit of %d exceeded", e.Kind, e.Limit)
+}
+
+// CheckScriptSize returns a *LimitError when a script of size bytes exceeds MaxScriptBytes.
+func (l Limits) CheckScriptSize(size int64) error {
+	if l.MaxScriptBytes > 0 && size > l.MaxScriptBytes {
+		return &LimitError{Kind: LimitScriptSize, Limit: l.MaxScriptBytes}
+	}
+	return nil
+}
+
+// checkNodes returns a *LimitError when p has more than MaxNodes nodes. It stops counting at
+// the limit.
+func (l Limits) checkNodes(p *ast.Program) error {
+	if l.MaxNodes <= 0 {
+		return nil
+	}
+	nodes := 0
+	astmatch.Walk(p, func(n ast.VisitableNode) bool {
+		if astmatch.Unwrap(n) == any(n) {
+			nodes++
+		}
+		return nodes <= l.MaxNodes
+	})
+	if nodes > l.MaxNodes {
+		return &LimitError{Kind: LimitNodes, Limit: int64(l.MaxNodes)}
+	}
+	return nil
+}
+
+// workBudget is the step count and deadline of one run, shared by every pass. A nil budget
+// is unlimited.
+type workBudget struct {
+	maxSteps int
+	steps    int
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func newWorkBudget(l Limits) *workBudget {
+	b := &workBudget{maxSteps: l.MaxSteps, timeout: l.Timeout}
+	if l.Timeout > 0 {
+		b.deadline = time.Now().Add(l.Timeout)
+	}
+	return b
+}
+
+// spend counts n steps of work. The clock is only read every 1024 steps.
+func (b *workBudget) spend(n int) error {
+	if b == nil {
+		return nil
+	}
+	before := b.steps
+	b.steps += n
+	if b.maxSteps > 0 && b.steps > b.maxSteps {
+		return &LimitError{Kind: LimitSteps, Limit: int64(b.maxSteps)}
+	}
+	if before>>10 != b.steps>>10 {
+		return b.check()
+	}
+	return nil
+}
+
+// check returns a *LimitError once the deadline has passed.
+func (b *workBudget) check() error {
+	if b == nil || b.deadline.IsZero() || time.Now().Before(b.deadline) {
+		return nil
+	}
+	return &LimitError{Kind: LimitTime, Limit: int64(b.timeout)}
+}
@@ -0,0 +1,99 @@
+package visitors
+
+import (
+	"fmt"
+
+	"github.com/t14raptor/go-fast/ast"
+)
+
+// QualityThresholds bounds the unresolved-obfuscation metrics of a deobfuscation run. A zero
+// field disables its check.
+type QualityThresholds struct {
+	// MaxUnresolvedDecoderRatio is the largest share of decoder calls that may stay unresolved.
+	MaxUnresolvedDecoderRatio float64
+	// MaxUnresolvedConstantLookups is the largest number of constant-object lookups that may
+	// stay in the output.
+	MaxUnresolvedConstantLookups int
+	// MinStringTableCoverage is the smallest share of string-table entries that resolved
+	// decoder calls must reference.
+	MinStringTableCoverage float64
+}
+
+func (q QualityThresholds) check(r *DeobfuscateResult) error {
+	total := r.ResolvedDecoderCalls + r.UnresolvedDecoderCalls
+	if q.MaxUnresolvedDecoderRatio > 0 && total > 0 {
+		if ratio := float64(r.UnresolvedDecoderCalls) / float64(total); ratio > q.MaxUnresolvedDecoderRatio {
+			return fmt.Errorf("%d of %d decoder calls unresolved (%.0f%%, limit %.0f%%)",
+				r.UnresolvedDecoderCalls, total, ratio*100, q.MaxUnresolvedDecoderRatio*100)
+		}
+	}
+	if q.MaxUnresolvedConstantLookups > 0 && r.UnresolvedConstantLookups > q.MaxUnresolvedConstantLookups {
+		return fmt.Errorf("%d constant-object lookups unresolved (limit %d)",
+			r.UnresolvedConstantLookups, q.MaxUnresolvedConstantLookups)
+	}
+	if q.MinStringTableCoverage > 0 && r.StringTableCoverage < q.MinStringTableCoverage {
+		return fmt.Errorf("only %.0f%% of the string table is referenced (minimum %.0f%%)",
+			r.StringTableCoverage*100, q.MinStringTableCoverage*100)
+	}
+	return nil
+}
+
+// countConstantLookups counts member lookups on constant number objects that survived inlining,
+// e.g. `gl[k]` with a non-literal key or a key the object does not define.
+func countConstantLookups(p *ast.Program, objects map[ast.Id]struct{}) int {
+	c := &constLookupCounter{objects: objects}
+	c.V = c
+	p.VisitWith(c)
+	return c.count
+}
+
+type constLookupCounter struct {
+	ast.NoopVisitor
+	objects map[ast.Id]struct{}
+	count   int
+}
+
+func (v *constLookupCounter) VisitMemberExpression(n *ast.MemberExpression) {
+	n.VisitChildrenWith(v)
+	if id, ok := n.Object.Expr.(*ast.Identifier); ok {
+		if _, ok := v.objects[id.ToId()]; ok {
+			v.count++
+		}
+	}
+}
+
+// countUnfoldedNumerics counts arithmetic and bitwise expressions whose operands are all number
+// literals, i.e. ones the folding pass left behind.
+func countUnfoldedNumerics(p *ast.Program) int {
+	c := &unfoldedNumericCounter{}
+	c.V = c
+	p.VisitWith(c)
+	return c.count
+}
+
+type unfoldedNumericCounter struct {
+	ast.NoopVisitor
+	count int
+}
+
+func (v *unfoldedNumericCounter) VisitExpression(n *ast.Expression) {
+	n.VisitChildrenWith(v)
+	switch expr := n.Expr.(type) {
+	case *ast.UnaryExpression:
+		switch expr.Operator.String() {
+		case "-", "+", "~":
+			if _, ok := expr.Operand.Expr.(*ast.NumberLiteral); ok {
+				v.count++
+			}
+		}
+	case *ast.BinaryExpression:
+		switch expr.Operator.String() {
+		case "+", "-", "*", "/", "%", "|", "&", "^", "<<", ">>", ">>>":
+			_, lok := expr.Left.Expr.(*ast.NumberLiteral)
+			_, rok := expr.Right.Expr.(*ast.NumberLiteral)
+			if lok && rok {
+				v.count++
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package visitors
+
+import (
+	"github.com/t14raptor/go-fast/ast"
+)
+
+// normalizeProgram runs the normalization passes enabled in opts, checking the work budget
+// after each of them.
+func normalizeProgram(p *ast.Program, opts Options, work *workBudget) error {
+	run := func(v ast.Visitor) error {
+		p.VisitWith(v)
+		return work.check()
+	}
+
+	if opts.UnwrapIIFEs {
+		v := &iifeUnwrapper{}
+		v.V = v
+		if err := run(v); err != nil {
+			return err
+		}
+	}
+
+	if opts.NormalizeLiterals {
+		v := &literalNormalizer{undefinedShadowed: isBindingDeclared(p, "undefined")}
+		v.V = v
+		if err := run(v); err != nil {
+			return err
+		}
+	}
+
+	if opts.DotMembers {
+		v := &memberDotter{}
+		v.V = v
+		if err := run(v); err != nil {
+			return err
+		}
+	}
+
+	if opts.HoistSequences {
+		v := &sequenceHoister{expanded: make(map[*ast.BlockStatement]struct{})}
+		v.V = v
+		if err := run(v); err != nil {
+			return err
+		}
+	}
+
+	if opts.SplitSequences {
+		v := &sequenceSplitter{expanded: make(map[*ast.BlockStatement]struct{})}
+		v.V = v
+		if err := run(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberDotter rewrites `a["prop"]` to `a.prop` whenever the key is a valid identifier name.
+type memberDotter struct {
+	ast.NoopVisitor
+}
+
+func (v *memberDotter) VisitMemberProperty(n *ast.MemberProperty) {
+	n.VisitChildrenWith(v)
+
+	computed, ok := n.Prop.(*ast.ComputedProperty)
+	if !ok || computed.Expr == nil {
+		return
+	}
+	key, ok := computed.Expr.Expr.(*ast.StringLiteral)
+	if !ok || !isIdentifierName(key.Value) {
+		return
+	}
+	n.Prop = &ast.Identifier{Idx: key.Idx, Name: key.Value}
+}
+
+func isIdentifierName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '$':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// literalNormalizer turns the minifier idioms `!0`, `!1` and `void 0` back into literals.
+type literalNormalizer struct {
+	ast.NoopVisitor
+	undefinedShadowed bool
+}
+
+func (v *literalNormalizer) VisitExpression(n *ast.Expression) {
+	n.VisitChildrenWith(v)
+
+	unary, ok := n.Expr.(*ast.UnaryExpression)
+	if !ok || unary.Operand == nil {
+		return
+	}
+
+	switch unary.Operator.String() {
+	case "!":
+		switch operand := unary.Operand.Expr.(type) {
+		case *ast.NumberLiteral:
+			n.Expr = &ast.BooleanLiteral{Idx: unary.Idx, Value: operand.Value == 0}
+		case *ast.BooleanLiteral:
+			n.Expr = &ast.BooleanLiteral{Idx: unary.Idx, Value: !operand.Value}
+		}
+	case "void":
+		if v.undefinedShadowed {
+			return
+		}
+		if _, ok := unary.Operand.Expr.(*ast.NumberLiteral); ok {
+			n.Expr = &ast.Identifier{Idx: unary.Idx, Name: "undefined"}
+		}
+	}
+}
+
+// iifeUnwrapper drops the operator minifiers put in front of statement-level IIFEs
+// (`!function(){}()`, `~function(){}()`), since the result is discarded anyway.
+type iifeUnwrapper struct {
+	ast.NoopVisitor
+}
+
+func (v *iifeUnwrapper) VisitExpressionStatement(n *ast.ExpressionStatement) {
+	n.VisitChildrenWith(v)
+
+	unary, ok := n.Expression.Expr.(*ast.UnaryExpression)
+	if !ok || unary.Operand == nil {
+		return
+	}
+	switch unary.Operator.String() {
+	case "!", "~", "+", "-", "void":
+	default:
+		return
+	}
+
+	call, ok := unary.Operand.Expr.(*ast.CallExpression)
+	if !ok {
+		return
+	}
+	switch call.Callee.Expr.(type) {
+	case *ast.FunctionLiteral, *ast.ArrowFunctionLiteral:
+		n.Expression = unary.Operand
+	}
+}
+
+// sequenceSplitter turns `a(), b(), c();` into three statements.
+type sequenceSplitter struct {
+	ast.NoopVisitor
+	expanded map[*ast.BlockStatement]struct{}
+}
+
+func (v *sequenceSplitter) VisitStatements(n *ast.Statements) {
+	n.VisitChildrenWith(v)
+	*n = flattenExpanded(*n, v.expanded)
+}
+
+func (v *sequenceSplitter) VisitStatement(n *ast.Statement) {
+	n.VisitChildrenWith(v)
+
+	stmt, ok := n.Stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return
+	}
+	exprs := flattenSequence(stmt.Expression)
+	if len(exprs) < 2 || !canStartStatements(exprs) {
+		return
+	}
+
+	block := &ast.BlockStatement{List: expressionStatements(exprs)}
+	v.expanded[block] = struct{}{}
+	n.Stmt = block
+}
+
+// sequenceHoister moves everything but the last expression of `return a, b, c` and
+// `if (a, b, c)` into statements of their own.
+type sequenceHoister struct {
+	ast.NoopVisitor
+	expanded map[*ast.BlockStatement]struct{}
+}
+
+func (v *sequenceHoister) VisitStatements(n *ast.Statements) {
+	n.VisitChildrenWith(v)
+	*n = flattenExpanded(*n, v.expanded)
+}
+
+func (v *sequenceHoister) VisitStatement(n *ast.Statement) {
+	n.VisitChildrenWith(v)
+
+	var target **ast.Expression
+	switch s := n.Stmt.(type) {
+	case *ast.ReturnStatement:
+		target = &s.Argument
+	case *ast.IfStatement:
+		target = &s.Test
+	default:
+		return
+	}
+	if *target == nil {
+		return
+	}
+
+	exprs := flattenSequence(*target)
+	if len(exprs) < 2 || !canStartStatements(exprs[:len(exprs)-1]) {
+		return
+	}
+
+	last := exprs[len(exprs)-1]
+	*target = &last
+
+	list := expressionStatements(exprs[:len(exprs)-1])
+	list = append(list, ast.Statement{Stmt: n.Stmt})
+	block := &ast.BlockStatement{List: list}
+	v.expanded[block] = struct{}{}
+	n.Stmt = block
+}
+
+func flattenSequence(e *ast.Expression) []ast.Expression {
+	if e == nil || e.Expr == nil {
+		return nil
+	}
+	seq, ok := e.Expr.(*ast.SequenceExpression)
+	if !ok {
+		return []ast.Expression{*e}
+	}
+	var out []ast.Expression
+	for i := range seq.Sequence {
+		out = append(out, flattenSequence(&seq.Sequence[i])...)
+	}
+	return out
+}
+
+func expressionStatements(exprs []ast.Expression) ast.Statements {
+	list := make(ast.Statements, 0, len(exprs)+1)
+	for i := range exprs {
+		list = append(list, ast.Statement{Stmt: &ast.ExpressionStatement{Expression: &exprs[i]}})
+	}
+	return list
+}
+
+// flattenExpanded splices blocks created by a splitting pass into the enclosing statement list.
+// Blocks that ended up as the body of an if/for/while stay in place.
+func flattenExpanded(list ast.Statements, expanded map[*ast.BlockStatement]struct{}) ast.Statements {
+	out := make(ast.Statements, 0, len(list))
+	for _, stmt := range list {
+		if block, ok := stmt.Stmt.(*ast.BlockStatement); ok {
+			if _, ours := expanded[block]; ours {
+				out = append(out, block.List...)
+				continue
+			}
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// canStartStatements reports whether each expression can be printed as its own statement. The
+// generator does not parenthesize a leading function or object literal, which would turn it into
+// a declaration or a block.
+func canStartStatements(exprs []ast.Expression) bool {
+	for i := range exprs {
+		if startsWithLiteralBody(exprs[i].Expr) {
+			return false
+		}
+	}
+	return true
+}
+
+func startsWithLiteralBody(e ast.Expr) bool {
+	switch n := e.(type) {
+	case *ast.FunctionLiteral, *ast.ObjectLiteral, *ast.ClassLiteral:
+		return true
+	case *ast.BinaryExpression:
+		return startsWithLiteralBody(n.Left.Expr)
+	case *ast.AssignExpression:
+		return startsWithLiteralBody(n.Left.Expr)
+	case *ast.ConditionalExpression:
+		return startsWithLiteralBody(n.Test.Expr)
+	case *ast.MemberExpression:
+		if _, ok := n.Object.Expr.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		return startsWithLiteralBody(n.Object.Expr)
+	case *ast.CallExpression:
+		if _, ok := n.Callee.Expr.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		return startsWithLiteralBody(n.Callee.Expr)
+	case *ast.UpdateExpression:
+		return n.Postfix && startsWithLiteralBody(n.Operand.Expr)
+	default:
+		return false
+	}
+}
+
+func isBindingDeclared(p *ast.Program, name string) bool {
+	f := &bindingNameFinder{name: name}
+	f.V = f
+	p.VisitWith(f)
+	return f.found
+}
+
+type bindingNameFinder struct {
+	ast.NoopVisitor
+	name  string
+	found bool
+}
+
+func (v *bindingNameFinder) VisitVariableDeclarator(n *ast.VariableDeclarator) {
+	if id, ok := n.Target.Target.(*ast.Identifier); ok && id.Name == v.name {
+		v.found = true
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *bindingNameFinder) VisitParameterList(n *ast.ParameterList) {
+	for _, d := range n.List {
+		if id, ok := d.Target.Target.(*ast.Identifier); ok && id.Name == v.name {
+			v.found = true
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *bindingNameFinder) VisitFunctionLiteral(n *ast.FunctionLiteral) {
+	if n.Name != nil && n.Name.Name == v.name {
+		v.found = true
+	}
+	n.VisitChildrenWith(v)
+}
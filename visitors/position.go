@@ -0,0 +1,108 @@
+package visitors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/t14raptor/go-fast/ast"
+)
+
+// Position is a location in a script. Line and Column are 1-based and zero when only the byte
+// Offset is known. Columns count UTF-16 code units, as browsers and source maps do.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("offset %d", p.Offset)
+	}
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// SourceFile is the text a program was parsed from. Passes given one through Options.Source
+// cite line and column positions in their errors instead of byte offsets.
+type SourceFile struct {
+	// Name is the file name source maps refer to, e.g. "main.js".
+	Name string
+	Text string
+
+	lines []int
+}
+
+// NewSourceFile indexes the line starts of text.
+func NewSourceFile(name, text string) *SourceFile {
+	f := &SourceFile{Name: name, Text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			f.lines = append(f.lines, i+1)
+		}
+	}
+	return f
+}
+
+// Position resolves a byte offset. A nil file only knows the offset.
+func (f *SourceFile) Position(offset int) Position {
+	if f == nil || offset < 0 || offset > len(f.Text) {
+		return Position{Offset: offset}
+	}
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	column := 0
+	for _, r := range f.Text[f.lines[line]:offset] {
+		column++
+		if r >= 0x10000 {
+			column++
+		}
+	}
+	return Position{Offset: offset, Line: line + 1, Column: column + 1}
+}
+
+// positionOf returns the position of n, or false for nodes that have none, such as ones a
+// pass created without carrying over the position of the node they replaced.
+func (f *SourceFile) positionOf(n any) (Position, bool) {
+	off := nodeOffset(n)
+	if off < 0 {
+		return Position{}, false
+	}
+	return f.Position(off), true
+}
+
+// PositionError is an error at a node of the original script.
+type PositionError struct {
+	Pos Position
+	Err error
+}
+
+func (e *PositionError) Error() string {
+	return e.Pos.String() + ": " + e.Err.Error()
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt attaches the position of n to err, unless n has none or err already has a position,
+// which is the more precise one.
+func (f *SourceFile) errorAt(n any, err error) error {
+	var posErr *PositionError
+	if errors.As(err, &posErr) {
+		return err
+	}
+	pos, ok := f.positionOf(n)
+	if !ok {
+		return err
+	}
+	return &PositionError{Pos: pos, Err: err}
+}
+
+// idxOf returns the position of n in the form go-fast nodes store it, for nodes a pass creates
+// in place of n.
+func idxOf(n any) ast.Idx {
+	if off := nodeOffset(n); off >= 0 {
+		return ast.Idx(off + 1)
+	}
+	return 0
+}
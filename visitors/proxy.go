@@ -0,0 +1,483 @@
+package visitors
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/t14raptor/go-fast/ast"
+	"github.com/t14raptor/go-fast/resolver"
+)
+
+// proxyFunction is a single-return wrapper such as `function(a, b) { return a + b }`.
+type proxyFunction struct {
+	params []string
+	body   *ast.Expression
+}
+
+// inlineProxyFunctions replaces calls to stable wrappers with their bodies and returns how many
+// calls it replaced. Wrappers and their call sites are matched by binding, so a parameter that
+// shadows a wrapper's name is not mistaken for it.
+func inlineProxyFunctions(p *ast.Program, work *workBudget) (inlined int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("proxy function inlining failed: %v", r)
+		}
+	}()
+	resolver.Resolve(p)
+
+	writes := collectBindingWrites(p)
+
+	collector := &proxyFnCollector{
+		funcs:   make(map[ast.Id]*proxyFunction),
+		objects: make(map[ast.Id]map[string]*proxyFunction),
+	}
+	collector.V = collector
+	p.VisitWith(collector)
+
+	for id := range collector.funcs {
+		if !writes.isStable(id) {
+			delete(collector.funcs, id)
+		}
+	}
+	for id := range collector.objects {
+		if !writes.isStable(id) {
+			delete(collector.objects, id)
+		}
+	}
+
+	if len(collector.funcs) == 0 && len(collector.objects) == 0 {
+		return 0, nil
+	}
+
+	inliner := &proxyFnInliner{
+		funcs:   collector.funcs,
+		objects: collector.objects,
+	}
+	inliner.V = inliner
+
+	// Wrappers are frequently passed through other wrappers (`o.a(o.b, x)`), so a single
+	// post-order walk can leave freshly exposed call sites behind.
+	total := 0
+	for i := 0; i < 8; i++ {
+		if err := work.check(); err != nil {
+			return total, err
+		}
+		inliner.inlined = 0
+		p.VisitWith(inliner)
+		total += inliner.inlined
+		if inliner.inlined == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+type proxyFnCollector struct {
+	ast.NoopVisitor
+	funcs   map[ast.Id]*proxyFunction
+	objects map[ast.Id]map[string]*proxyFunction
+}
+
+func (v *proxyFnCollector) VisitStatement(n *ast.Statement) {
+	n.VisitChildrenWith(v)
+
+	decl, ok := n.Stmt.(*ast.VariableDeclaration)
+	if !ok {
+		return
+	}
+	for i := range decl.List {
+		d := decl.List[i]
+		if d.Initializer == nil || d.Target == nil || d.Target.Target == nil {
+			continue
+		}
+		id, ok := d.Target.Target.(*ast.Identifier)
+		if !ok {
+			continue
+		}
+		v.capture(id, d.Initializer.Expr)
+	}
+}
+
+func (v *proxyFnCollector) VisitExpression(n *ast.Expression) {
+	n.VisitChildrenWith(v)
+
+	assign, ok := n.Expr.(*ast.AssignExpression)
+	if !ok || assign.Operator.String() != "=" {
+		return
+	}
+	left, ok := assign.Left.Expr.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	v.capture(left, assign.Right.Expr)
+}
+
+func (v *proxyFnCollector) capture(left *ast.Identifier, right ast.Expr) {
+	switch r := right.(type) {
+	case *ast.FunctionLiteral:
+		if fn, ok := asProxyFunction(r); ok {
+			v.funcs[left.ToId()] = fn
+		}
+	case *ast.ObjectLiteral:
+		props := make(map[string]*proxyFunction)
+		for _, entry := range r.Value {
+			prop, ok := entry.Prop.(*ast.PropertyKeyed)
+			if !ok || prop.Computed || prop.Kind != ast.PropertyKindValue {
+				continue
+			}
+			keyName, ok := literalKeyName(prop.Key)
+			if !ok || prop.Value == nil {
+				continue
+			}
+			lit, ok := prop.Value.Expr.(*ast.FunctionLiteral)
+			if !ok {
+				continue
+			}
+			if fn, ok := asProxyFunction(lit); ok {
+				props[keyName] = fn
+			}
+		}
+		if len(props) > 0 {
+			v.objects[left.ToId()] = props
+		}
+	}
+}
+
+// asProxyFunction accepts functions whose body is a lone return of an expression built only
+// from its own parameters and literals, so the expression can be moved to any call site.
+func asProxyFunction(fn *ast.FunctionLiteral) (*proxyFunction, bool) {
+	if fn == nil || fn.Async || fn.Generator || fn.Body == nil || fn.ParameterList.Rest != nil {
+		return nil, false
+	}
+	if len(fn.Body.List) != 1 {
+		return nil, false
+	}
+	ret, ok := fn.Body.List[0].Stmt.(*ast.ReturnStatement)
+	if !ok || ret.Argument == nil || ret.Argument.Expr == nil {
+		return nil, false
+	}
+
+	params := make([]string, 0, len(fn.ParameterList.List))
+	for _, d := range fn.ParameterList.List {
+		if d.Initializer != nil || d.Target == nil {
+			return nil, false
+		}
+		id, ok := d.Target.Target.(*ast.Identifier)
+		if !ok {
+			return nil, false
+		}
+		params = append(params, id.Name)
+	}
+
+	if !isProxyBody(ret.Argument, params) {
+		return nil, false
+	}
+	return &proxyFunction{params: params, body: ret.Argument}, true
+}
+
+func isProxyBody(e *ast.Expression, params []string) bool {
+	if e == nil || e.Expr == nil {
+		return false
+	}
+	switch n := e.Expr.(type) {
+	case *ast.Identifier:
+		for _, p := range params {
+			if p == n.Name {
+				return true
+			}
+		}
+		return false
+	case *ast.NumberLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	case *ast.BinaryExpression:
+		return isProxyBody(n.Left, params) && isProxyBody(n.Right, params)
+	case *ast.UnaryExpression:
+		if n.Operator.String() == "delete" {
+			return false
+		}
+		return isProxyBody(n.Operand, params)
+	case *ast.ConditionalExpression:
+		return isProxyBody(n.Test, params) && isProxyBody(n.Consequent, params) && isProxyBody(n.Alternate, params)
+	case *ast.MemberExpression:
+		if !isProxyBody(n.Object, params) {
+			return false
+		}
+		if computed, ok := n.Property.Prop.(*ast.ComputedProperty); ok {
+			return isProxyBody(computed.Expr, params)
+		}
+		return true
+	case *ast.CallExpression:
+		if !isProxyBody(n.Callee, params) {
+			return false
+		}
+		for i := range n.ArgumentList {
+			if !isProxyBody(&n.ArgumentList[i], params) {
+				return false
+			}
+		}
+		return true
+	case *ast.NewExpression:
+		if !isProxyBody(n.Callee, params) {
+			return false
+		}
+		for i := range n.ArgumentList {
+			if !isProxyBody(&n.ArgumentList[i], params) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+type proxyFnInliner struct {
+	ast.NoopVisitor
+	funcs   map[ast.Id]*proxyFunction
+	objects map[ast.Id]map[string]*proxyFunction
+	inlined int
+}
+
+func (v *proxyFnInliner) VisitExpression(n *ast.Expression) {
+	n.VisitChildrenWith(v)
+
+	call, ok := n.Expr.(*ast.CallExpression)
+	if !ok {
+		return
+	}
+
+	var fn *proxyFunction
+	switch callee := call.Callee.Expr.(type) {
+	case *ast.Identifier:
+		fn = v.funcs[callee.ToId()]
+	case *ast.MemberExpression:
+		obj, ok := callee.Object.Expr.(*ast.Identifier)
+		if !ok {
+			return
+		}
+		propName, ok := memberPropName(callee.Property)
+		if !ok {
+			return
+		}
+		if props := v.objects[obj.ToId()]; props != nil {
+			fn = props[propName]
+		}
+	}
+	if fn == nil || len(call.ArgumentList) != len(fn.params) {
+		return
+	}
+
+	if replaced, ok := fn.instantiate(call.ArgumentList); ok {
+		n.Expr = replaced.Expr
+		v.inlined++
+	}
+}
+
+// instantiate returns a copy of the wrapper body with every parameter replaced by its argument.
+// Arguments with side effects are only moved when the body evaluates each parameter exactly once
+// and in declaration order, so the call site keeps its evaluation order.
+func (fn *proxyFunction) instantiate(args ast.Expressions) (*ast.Expression, bool) {
+	bound := make(map[string]*ast.Expression, len(fn.params))
+	pure := true
+	for i, name := range fn.params {
+		bound[name] = &args[i]
+		if !isSideEffectFree(args[i].Expr) {
+			pure = false
+		}
+	}
+
+	body := fn.body.Clone()
+	sub := &paramSubstituter{args: bound}
+	sub.V = sub
+	body.VisitWith(sub)
+	if sub.invalid {
+		return nil, false
+	}
+
+	if !pure {
+		if len(sub.order) != len(fn.params) {
+			return nil, false
+		}
+		for i, name := range sub.order {
+			if name != fn.params[i] {
+				return nil, false
+			}
+		}
+	}
+	return body, true
+}
+
+type paramSubstituter struct {
+	ast.NoopVisitor
+	args    map[string]*ast.Expression
+	order   []string
+	invalid bool
+}
+
+func (v *paramSubstituter) VisitCallExpression(n *ast.CallExpression) {
+	// The generator does not parenthesize compound callees, so only callee-safe shapes are
+	// allowed to replace a parameter used as the function being called.
+	if id, ok := n.Callee.Expr.(*ast.Identifier); ok {
+		if arg, ok := v.args[id.Name]; ok {
+			switch arg.Expr.(type) {
+			case *ast.Identifier, *ast.MemberExpression, *ast.CallExpression, *ast.FunctionLiteral:
+			default:
+				v.invalid = true
+			}
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *paramSubstituter) VisitExpression(n *ast.Expression) {
+	if id, ok := n.Expr.(*ast.Identifier); ok {
+		if arg, ok := v.args[id.Name]; ok {
+			v.order = append(v.order, id.Name)
+			n.Expr = arg.Clone().Expr
+		}
+		return
+	}
+	n.VisitChildrenWith(v)
+}
+
+func isSideEffectFree(e ast.Expr) bool {
+	switch n := e.(type) {
+	case *ast.Identifier, *ast.NumberLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	case *ast.UnaryExpression:
+		op := n.Operator.String()
+		return op != "delete" && isSideEffectFree(n.Operand.Expr)
+	default:
+		return false
+	}
+}
+
+// bindingWrites records how often each binding is assigned and whether any of its members
+// are written to, so passes can skip values that change after their definition.
+type bindingWrites struct {
+	ast.NoopVisitor
+	assigns      map[ast.Id]int
+	memberWrites map[ast.Id]bool
+	// args is the argument count of functions that are called where they are defined.
+	args map[*ast.ParameterList]int
+}
+
+func newBindingWrites() *bindingWrites {
+	w := &bindingWrites{
+		assigns:      make(map[ast.Id]int),
+		memberWrites: make(map[ast.Id]bool),
+		args:         make(map[*ast.ParameterList]int),
+	}
+	w.V = w
+	return w
+}
+
+func collectBindingWrites(p *ast.Program) *bindingWrites {
+	w := newBindingWrites()
+	p.VisitWith(w)
+	return w
+}
+
+func (w *bindingWrites) isStable(id ast.Id) bool {
+	return w.assigns[id] <= 1 && !w.memberWrites[id]
+}
+
+func (w *bindingWrites) VisitVariableDeclarator(n *ast.VariableDeclarator) {
+	n.VisitChildrenWith(w)
+	if n.Initializer == nil || n.Target == nil {
+		return
+	}
+	if id, ok := n.Target.Target.(*ast.Identifier); ok {
+		w.assigns[id.ToId()]++
+	}
+}
+
+func (w *bindingWrites) VisitCallExpression(n *ast.CallExpression) {
+	var params *ast.ParameterList
+	switch fn := n.Callee.Expr.(type) {
+	case *ast.FunctionLiteral:
+		params = &fn.ParameterList
+	case *ast.ArrowFunctionLiteral:
+		params = &fn.ParameterList
+	}
+	if params != nil && !slices.ContainsFunc(n.ArgumentList, func(e ast.Expression) bool {
+		_, spread := e.Expr.(*ast.SpreadElement)
+		return spread
+	}) {
+		w.args[params] = len(n.ArgumentList)
+	}
+	n.VisitChildrenWith(w)
+}
+
+// VisitParameterList counts the parameters a call may bind as assigned. Those past the
+// arguments of an immediately invoked function, like the wrappers the obfuscator declares as
+// parameters of its outer function, start out undefined as a bare var would. Parameters with
+// a default are counted as declarators.
+func (w *bindingWrites) VisitParameterList(n *ast.ParameterList) {
+	n.VisitChildrenWith(w)
+	bound, iife := w.args[n]
+	for i, d := range n.List {
+		if iife && i >= bound {
+			break
+		}
+		if d.Initializer != nil || d.Target == nil {
+			continue
+		}
+		if id, ok := d.Target.Target.(*ast.Identifier); ok {
+			w.assigns[id.ToId()]++
+		}
+	}
+	if id, ok := n.Rest.(*ast.Identifier); ok {
+		w.assigns[id.ToId()]++
+	}
+}
+
+// VisitCatchStatement counts the catch binding as assigned. The resolver gives it no scope of
+// its own, so it shares its id with a binding of the same name outside.
+func (w *bindingWrites) VisitCatchStatement(n *ast.CatchStatement) {
+	n.VisitChildrenWith(w)
+	if n.Parameter == nil {
+		return
+	}
+	if id, ok := n.Parameter.Target.(*ast.Identifier); ok {
+		w.assigns[id.ToId()]++
+	}
+}
+
+func (w *bindingWrites) VisitFunctionDeclaration(n *ast.FunctionDeclaration) {
+	n.VisitChildrenWith(w)
+	if n.Function != nil && n.Function.Name != nil {
+		w.assigns[n.Function.Name.ToId()]++
+	}
+}
+
+func (w *bindingWrites) VisitAssignExpression(n *ast.AssignExpression) {
+	n.VisitChildrenWith(w)
+	w.recordWrite(n.Left)
+}
+
+func (w *bindingWrites) VisitUpdateExpression(n *ast.UpdateExpression) {
+	n.VisitChildrenWith(w)
+	w.recordWrite(n.Operand)
+}
+
+func (w *bindingWrites) VisitUnaryExpression(n *ast.UnaryExpression) {
+	n.VisitChildrenWith(w)
+	if n.Operator.String() == "delete" {
+		w.recordWrite(n.Operand)
+	}
+}
+
+func (w *bindingWrites) recordWrite(target *ast.Expression) {
+	if target == nil {
+		return
+	}
+	switch t := target.Expr.(type) {
+	case *ast.Identifier:
+		w.assigns[t.ToId()]++
+	case *ast.MemberExpression:
+		if obj, ok := t.Object.Expr.(*ast.Identifier); ok {
+			w.memberWrites[obj.ToId()] = true
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package visitors
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/t14raptor/go-fast/ast"
+	"github.com/t14raptor/go-fast/resolver"
+)
+
+// renameRoles names the bindings whose purpose is known from the analysis. Everything else gets
+// a positional name built from the index of its enclosing function.
+type renameRoles struct {
+	// decoders and stringTables list one entry per string group, so the second decoder of a
+	// bundle becomes decoder2.
+	decoders     []string
+	stringTables []string
+	aliases      map[string]struct{}
+	lzAlphabet   string
+}
+
+func renameBindings(p *ast.Program, roles renameRoles) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("scope resolution failed: %v", r)
+		}
+	}()
+	resolver.Resolve(p)
+
+	names := &identNameCollector{names: make(map[string]struct{})}
+	names.V = names
+	p.VisitWith(names)
+
+	binder := &bindingNamer{
+		roles:    roles,
+		taken:    names.names,
+		renames:  make(map[ast.Id]string),
+		counters: make(map[string]int),
+		fnStack:  []int{-1},
+	}
+	binder.V = binder
+	p.VisitWith(binder)
+
+	renamer := &bindingRenamer{renames: binder.renames}
+	renamer.V = renamer
+	p.VisitWith(renamer)
+	return nil
+}
+
+type identNameCollector struct {
+	ast.NoopVisitor
+	names map[string]struct{}
+}
+
+func (v *identNameCollector) VisitIdentifier(n *ast.Identifier) {
+	v.names[n.Name] = struct{}{}
+}
+
+// bindingNamer walks declarations in source order and assigns each binding its new name, so the
+// result only depends on the shape of the script.
+type bindingNamer struct {
+	ast.NoopVisitor
+	roles    renameRoles
+	taken    map[string]struct{}
+	renames  map[ast.Id]string
+	counters map[string]int
+	fnCount  int
+	fnStack  []int
+}
+
+func (v *bindingNamer) scopePrefix() string {
+	if fn := v.fnStack[len(v.fnStack)-1]; fn >= 0 {
+		return "fn_" + strconv.Itoa(fn)
+	}
+	return "global"
+}
+
+func (v *bindingNamer) next(prefix, kind string) string {
+	key := prefix + "_" + kind
+	n := v.counters[key]
+	v.counters[key] = n + 1
+	return key + strconv.Itoa(n)
+}
+
+func (v *bindingNamer) bind(id *ast.Identifier, name string) {
+	if id == nil {
+		return
+	}
+	key := id.ToId()
+	if _, ok := v.renames[key]; ok {
+		return
+	}
+
+	if _, isAlias := v.roles.aliases[id.Name]; isAlias && !slices.Contains(v.roles.decoders, id.Name) {
+		name = "decoderAlias" + strconv.Itoa(v.counters["decoderAlias"])
+		v.counters["decoderAlias"]++
+	}
+	v.renames[key] = v.reserve(name)
+}
+
+// rebind replaces a positional name once a later assignment reveals the binding's role.
+func (v *bindingNamer) rebind(id *ast.Identifier, name string) {
+	key := id.ToId()
+	if old, ok := v.renames[key]; ok && !isPositionalName(old) {
+		return
+	}
+	v.renames[key] = v.reserve(name)
+}
+
+func (v *bindingNamer) reserve(name string) string {
+	for {
+		if _, clash := v.taken[name]; !clash {
+			break
+		}
+		name += "_"
+	}
+	v.taken[name] = struct{}{}
+	return name
+}
+
+// roleName numbers the roles of every string group after the first.
+func roleName(role string, group int) string {
+	if group == 0 {
+		return role
+	}
+	return role + strconv.Itoa(group+1)
+}
+
+func isPositionalName(name string) bool {
+	return strings.HasPrefix(name, "fn_") || strings.HasPrefix(name, "global_")
+}
+
+func (v *bindingNamer) enterFunction(name *ast.Identifier, params *ast.ParameterList, body ast.VisitableNode) {
+	idx := v.fnCount
+	v.fnCount++
+
+	if name != nil {
+		if i := slices.Index(v.roles.decoders, name.Name); i >= 0 {
+			v.bind(name, roleName("decoder", i))
+		} else if i := slices.Index(v.roles.stringTables, name.Name); i >= 0 {
+			v.bind(name, roleName("stringTable", i))
+		} else {
+			v.bind(name, "fn_"+strconv.Itoa(idx))
+		}
+	}
+
+	v.fnStack = append(v.fnStack, idx)
+	prefix := v.scopePrefix()
+	for i := range params.List {
+		if id, ok := params.List[i].Target.Target.(*ast.Identifier); ok {
+			v.bind(id, prefix+"_param"+strconv.Itoa(i))
+		}
+		if params.List[i].Initializer != nil {
+			params.List[i].Initializer.VisitWith(v)
+		}
+	}
+	if rest, ok := params.Rest.(*ast.Identifier); ok {
+		v.bind(rest, prefix+"_rest")
+	}
+	body.VisitWith(v)
+	v.fnStack = v.fnStack[:len(v.fnStack)-1]
+}
+
+func (v *bindingNamer) VisitFunctionLiteral(n *ast.FunctionLiteral) {
+	v.enterFunction(n.Name, &n.ParameterList, n.Body)
+}
+
+func (v *bindingNamer) VisitArrowFunctionLiteral(n *ast.ArrowFunctionLiteral) {
+	v.enterFunction(nil, &n.ParameterList, n.Body)
+}
+
+func (v *bindingNamer) VisitVariableDeclarator(n *ast.VariableDeclarator) {
+	if id, ok := n.Target.Target.(*ast.Identifier); ok {
+		v.bind(id, v.nameForValue(n.Initializer, "var"))
+	}
+	if n.Initializer != nil {
+		n.Initializer.VisitWith(v)
+	}
+}
+
+func (v *bindingNamer) VisitCatchStatement(n *ast.CatchStatement) {
+	if n.Parameter != nil {
+		if id, ok := n.Parameter.Target.(*ast.Identifier); ok {
+			v.bind(id, v.next(v.scopePrefix(), "err"))
+		}
+	}
+	n.Body.VisitWith(v)
+}
+
+func (v *bindingNamer) VisitAssignExpression(n *ast.AssignExpression) {
+	// Parameters reused as locals (`function(a, b, c) { c = "..." }`) are bound before their
+	// value is known, so an assignment can still reveal the role of the binding.
+	if left, ok := n.Left.Expr.(*ast.Identifier); ok && v.roles.lzAlphabet != "" {
+		if lit, ok := n.Right.Expr.(*ast.StringLiteral); ok && lit.Value == v.roles.lzAlphabet {
+			v.rebind(left, "lzAlphabet")
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *bindingNamer) nameForValue(init *ast.Expression, kind string) string {
+	if init != nil && v.roles.lzAlphabet != "" {
+		if lit, ok := init.Expr.(*ast.StringLiteral); ok && lit.Value == v.roles.lzAlphabet {
+			return "lzAlphabet"
+		}
+	}
+	return v.next(v.scopePrefix(), kind)
+}
+
+// bindingRenamer rewrites every reference to a renamed binding. Property names, object keys and
+// labels share the identifier node type but are not bindings, so they are skipped.
+type bindingRenamer struct {
+	ast.NoopVisitor
+	renames map[ast.Id]string
+}
+
+func (v *bindingRenamer) VisitIdentifier(n *ast.Identifier) {
+	if name, ok := v.renames[n.ToId()]; ok {
+		n.Name = name
+	}
+}
+
+func (v *bindingRenamer) VisitMemberProperty(n *ast.MemberProperty) {
+	if computed, ok := n.Prop.(*ast.ComputedProperty); ok {
+		computed.VisitWith(v)
+	}
+}
+
+func (v *bindingRenamer) VisitProperty(n *ast.Property) {
+	if short, ok := n.Prop.(*ast.PropertyShort); ok && short.Initializer == nil {
+		if name, ok := v.renames[short.Name.ToId()]; ok {
+			n.Prop = &ast.PropertyKeyed{
+				Key:   &ast.Expression{Expr: &ast.Identifier{Idx: short.Name.Idx, Name: short.Name.Name}},
+				Kind:  ast.PropertyKindValue,
+				Value: &ast.Expression{Expr: &ast.Identifier{Idx: short.Name.Idx, Name: name}},
+			}
+			return
+		}
+	}
+	n.VisitChildrenWith(v)
+}
+
+func (v *bindingRenamer) VisitPropertyKeyed(n *ast.PropertyKeyed) {
+	if n.Computed {
+		n.Key.VisitWith(v)
+	}
+	n.Value.VisitWith(v)
+}
+
+func (v *bindingRenamer) VisitLabelledStatement(n *ast.LabelledStatement) {
+	n.Statement.VisitWith(v)
+}
+
+func (v *bindingRenamer) VisitBreakStatement(n *ast.BreakStatement) {}
+
+func (v *bindingRenamer) VisitContinueStatement(n *ast.ContinueStatement) {}
+
+func (v *bindingRenamer) VisitMetaProperty(n *ast.MetaProperty) {}
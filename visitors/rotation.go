@@ -0,0 +1,121 @@
+package visitors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// DefaultRotationStepBudget is the number of statements and expressions the rotation evaluator
+// may execute when Options.RotationStepBudget is zero.
+const DefaultRotationStepBudget = 1 << 20
+
+var errNoRotationIIFE = errors.New("no rotation IIFE found")
+
+// evaluateRotation locates the IIFE in the group's scope that receives its string-table
+// function and runs it against table. The decoder and its aliases read the same array the IIFE
+// rotates, so the loop's checksum sees every intermediate rotation exactly as the script would.
+// They decode entries with encoding, throwing like the script's decoder when an entry does not
+// decode. indexMaps are visible as globals, for loops that read them from the enclosing scope.
+// It returns errNoRotationIIFE when the script has no such call.
+func evaluateRotation(g *stringGroup, table []string, indexMaps map[string]map[string]int, encoding *stringEncoding, budget int) ([]string, error) {
+	tableFn, offset, aliases := g.tableFn, g.offset, g.aliases
+	if tableFn == "" {
+		return nil, errNoRotationIIFE
+	}
+	call := findRotationIIFE(g.root, tableFn)
+	if call == nil {
+		return nil, errNoRotationIIFE
+	}
+
+	if budget <= 0 {
+		budget = DefaultRotationStepBudget
+	}
+	e := &evaluator{budget: budget, src: g.src, work: g.work}
+
+	shared := &jsArray{elems: make([]any, len(table))}
+	for i, s := range table {
+		shared.elems[i] = s
+	}
+
+	global := newEvalScope(nil, true)
+	global.vars[tableFn] = &jsFunction{native: func([]any) (any, error) {
+		return shared, nil
+	}}
+	decoder := &jsFunction{native: func(args []any) (any, error) {
+		if len(args) == 0 {
+			return undefined, nil
+		}
+		idx := toJSNumber(args[0]) - float64(offset)
+		if idx != math.Trunc(idx) || idx < 0 || idx >= float64(len(shared.elems)) {
+			return undefined, nil
+		}
+		raw, ok := shared.elems[int(idx)].(string)
+		if !ok || encoding == nil {
+			return shared.elems[int(idx)], nil
+		}
+		var key string
+		if len(args) > 1 {
+			key = toJSString(args[1])
+		}
+		s, err := encoding.decode(raw, key)
+		if err != nil {
+			return nil, &jsThrow{value: "URIError: " + err.Error()}
+		}
+		return s, nil
+	}}
+	for name := range aliases {
+		global.vars[name] = decoder
+	}
+	global.vars["parseInt"] = &jsFunction{native: evalParseInt}
+	global.vars["parseFloat"] = &jsFunction{native: evalParseFloat}
+	for name, m := range indexMaps {
+		obj := &jsObject{props: make(map[string]any, len(m))}
+		for k, idx := range m {
+			obj.props[k] = float64(idx)
+		}
+		global.vars[name] = obj
+	}
+
+	callee := call.Callee.Expr.(*ast.FunctionLiteral)
+	args, err := e.evalArgs(call.ArgumentList, global)
+	if err == nil {
+		_, err = e.callFunction(e.closure(callee, global), args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotation IIFE: %w", err)
+	}
+
+	rotated := make([]string, len(shared.elems))
+	for i, v := range shared.elems {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("rotation IIFE left a %s at string-table index %d", jsTypeOf(v), i)
+		}
+		rotated[i] = s
+	}
+	return rotated, nil
+}
+
+// findRotationIIFE returns the first call of a function literal that is passed the
+// string-table function, e.g. `function(c,d){...}(a,1285613)`.
+func findRotationIIFE(root ast.VisitableNode, tableFn string) *ast.CallExpression {
+	m, ok := astmatch.FindFirst(root, astmatch.All(
+		astmatch.Call(astmatch.Is[*ast.FunctionLiteral](), astmatch.Rest()),
+		astmatch.Where(func(call *ast.CallExpression) bool {
+			return slices.ContainsFunc(call.ArgumentList, func(arg ast.Expression) bool {
+				_, ok := astmatch.Matches(&arg, astmatch.Ident(tableFn))
+				return ok
+			})
+		}),
+	))
+	if !ok {
+		return nil
+	}
+	return m.Node.(*ast.CallExpression)
+}
@@ -0,0 +1,159 @@
+package visitors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t14raptor/go-fast/ast"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// ScriptSignature fingerprints the structure of a script: the kinds of its nodes and their
+// operators, without identifier names or literal values. A string table is one node however
+// many entries it has, and the entries of object literals count in any order, so rebuilds of
+// the same script with fresh mangling, a reshuffled table or shuffled lookup objects share a
+// signature. It must run on the program as parsed, before deobfuscation rewrites it.
+func ScriptSignature(p *ast.Program) string {
+	h := shapeHasher{
+		label: shapeLabel,
+		leaf: func(n ast.VisitableNode) bool {
+			_, table := astmatch.Matches(n, stringTableArray)
+			return table
+		},
+	}
+	sum := h.hash(p)
+	return hex.EncodeToString(sum[:16])
+}
+
+// shapeHasher hashes a subtree by the labels of its nodes. A node leaf reports true for counts by
+// its label alone.
+type shapeHasher struct {
+	label func(ast.VisitableNode) string
+	leaf  func(ast.VisitableNode) bool
+}
+
+func (sh shapeHasher) hash(n ast.VisitableNode) [32]byte {
+	h := sha256.New()
+	h.Write([]byte(sh.label(n)))
+
+	var children []ast.VisitableNode
+	if !sh.leaf(n) {
+		children = astmatch.Children(n)
+	}
+	sums := make([][32]byte, len(children))
+	for i, c := range children {
+		sums[i] = sh.hash(c)
+	}
+	if _, ok := n.(*ast.ObjectLiteral); ok {
+		slices.SortFunc(sums, func(a, b [32]byte) int { return bytes.Compare(a[:], b[:]) })
+	}
+	for _, s := range sums {
+		h.Write(s[:])
+	}
+
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// shapeLabel names the kind of n, with the operator for operator nodes.
+func shapeLabel(n ast.VisitableNode) string {
+	label := reflect.TypeOf(n).Elem().Name()
+	switch n := n.(type) {
+	case *ast.BinaryExpression:
+		label += n.Operator.String()
+	case *ast.UnaryExpression:
+		label += n.Operator.String()
+	case *ast.AssignExpression:
+		label += n.Operator.String()
+	case *ast.UpdateExpression:
+		label += n.Operator.String()
+		if n.Postfix {
+			label += "post"
+		}
+	case *ast.VariableDeclaration:
+		label += n.Token.String()
+	}
+	return label
+}
+
+// Variant describes a known script variant.
+type Variant struct {
+	Signature string    `json:"signature"`
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// VariantRegistry maps script signatures to the variants they belong to. It is safe for
+// concurrent use.
+type VariantRegistry struct {
+	mu       sync.RWMutex
+	variants map[string]Variant
+}
+
+// NewVariantRegistry returns a registry holding variants.
+func NewVariantRegistry(variants ...Variant) *VariantRegistry {
+	r := &VariantRegistry{variants: make(map[string]Variant)}
+	for _, v := range variants {
+		r.variants[v.Signature] = v
+	}
+	return r
+}
+
+// LoadVariantRegistry reads a registry written by Save: a JSON array of variants.
+func LoadVariantRegistry(rd io.Reader) (*VariantRegistry, error) {
+	var variants []Variant
+	if err := json.NewDecoder(rd).Decode(&variants); err != nil {
+		return nil, fmt.Errorf("failed to decode variant registry: %w", err)
+	}
+	for i, v := range variants {
+		if v.Signature == "" {
+			return nil, fmt.Errorf("variant %d (%q) has no signature", i, v.Name)
+		}
+	}
+	return NewVariantRegistry(variants...), nil
+}
+
+// Lookup returns the variant with signature sig. A nil registry knows no variants.
+func (r *VariantRegistry) Lookup(sig string) (Variant, bool) {
+	if r == nil {
+		return Variant{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.variants[sig]
+	return v, ok
+}
+
+// Add records v, replacing any variant with the same signature.
+func (r *VariantRegistry) Add(v Variant) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.variants[v.Signature] = v
+}
+
+// Save writes the registry as a JSON array sorted by signature.
+func (r *VariantRegistry) Save(w io.Writer) error {
+	r.mu.RLock()
+	variants := make([]Variant, 0, len(r.variants))
+	for _, v := range r.variants {
+		variants = append(variants, v)
+	}
+	r.mu.RUnlock()
+	slices.SortFunc(variants, func(a, b Variant) int { return strings.Compare(a.Signature, b.Signature) })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(variants)
+}
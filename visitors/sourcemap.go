@@ -0,0 +1,127 @@
+package visitors
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/t14raptor/go-fast/ast"
+	fastgen "github.com/t14raptor/go-fast/generator"
+	"github.com/t14raptor/go-fast/parser"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+)
+
+// SourceMap is a Source Map v3 document, ready for encoding/json.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file,omitempty"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+// GenerateWithSourceMap prints the deobfuscated program p and maps the output back to src,
+// the script p was parsed from. Every node that kept its original position is mapped: nodes
+// the script already had, and the literals passes put in place of decoder calls, constant
+// lookups and folded arithmetic. file names the generated file in the map.
+//
+// The generator does not report where it prints a node, so the output is parsed again and
+// walked in step with p; where the two trees differ in shape, as for a negative number literal
+// that reads back as a negation, only the node itself is mapped and its subtree is skipped.
+func GenerateWithSourceMap(p *ast.Program, src *SourceFile, file string) (string, *SourceMap, error) {
+	code := fastgen.Generate(p)
+	reparsed, err := parser.ParseFile(code)
+	if err != nil {
+		return "", nil, fmt.Errorf("generated code does not parse: %w", err)
+	}
+
+	// Generated offset to original offset. Pairs come outermost first, so a node sharing its
+	// start with its parent, like the callee of a call, overrides it with the finer position.
+	mapping := make(map[int]int)
+	alignNodes(p, reparsed, func(orig, gen ast.VisitableNode) {
+		from, to := nodeOffset(gen), nodeOffset(orig)
+		if from >= 0 && to >= 0 {
+			mapping[from] = to
+		}
+	})
+
+	genFile := NewSourceFile(file, code)
+	offsets := make([]int, 0, len(mapping))
+	for off := range mapping {
+		offsets = append(offsets, off)
+	}
+	slices.Sort(offsets)
+
+	var b strings.Builder
+	var prev struct{ genLine, genCol, line, col int }
+	prev.genLine = 1
+	first := true
+	for _, off := range offsets {
+		gen, orig := genFile.Position(off), src.Position(mapping[off])
+		if gen.Line != prev.genLine {
+			b.WriteString(strings.Repeat(";", gen.Line-prev.genLine))
+			prev.genLine, prev.genCol, first = gen.Line, 0, true
+		}
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		// Segments are zero-based: generated column, source index, original line and
+		// original column, each relative to the previous segment.
+		writeVLQ(&b, gen.Column-1-prev.genCol)
+		writeVLQ(&b, 0)
+		writeVLQ(&b, orig.Line-1-prev.line)
+		writeVLQ(&b, orig.Column-1-prev.col)
+		prev.genCol, prev.line, prev.col = gen.Column-1, orig.Line-1, orig.Column-1
+	}
+
+	return code, &SourceMap{
+		Version:        3,
+		File:           file,
+		Sources:        []string{src.Name},
+		SourcesContent: []string{src.Text},
+		Names:          []string{},
+		Mappings:       b.String(),
+	}, nil
+}
+
+// alignNodes calls fn for a and b and walks their children in step for as long as the two
+// trees have the same shape.
+func alignNodes(a, b ast.VisitableNode, fn func(a, b ast.VisitableNode)) {
+	fn(a, b)
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return
+	}
+	ac, bc := astmatch.Children(a), astmatch.Children(b)
+	if len(ac) != len(bc) {
+		return
+	}
+	for i := range ac {
+		alignNodes(ac[i], bc[i], fn)
+	}
+}
+
+const base64VLQ = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// writeVLQ appends v in the base64 VLQ form of source map segments: the sign in the lowest bit,
+// then five bits per digit with a continuation bit.
+func writeVLQ(b *strings.Builder, v int) {
+	u := v << 1
+	if v < 0 {
+		u = -v<<1 | 1
+	}
+	for {
+		digit := u & 31
+		u >>= 5
+		if u > 0 {
+			digit |= 32
+		}
+		b.WriteByte(base64VLQ[digit])
+		if u == 0 {
+			return
+		}
+	}
+}
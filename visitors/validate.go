@@ -0,0 +1,133 @@
+package visitors
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/t14raptor/go-fast/ast"
+	"github.com/t14raptor/go-fast/parser"
+
+	"github.com/fxnatic/jsd-solver-go/astmatch"
+	"github.com/fxnatic/jsd-solver-go/jsnum"
+)
+
+// ValidationError lists the checks a deobfuscated program failed.
+type ValidationError struct {
+	Diagnostics []string
+}
+
+func (e *ValidationError) Error() string {
+	return "output validation failed: " + strings.Join(e.Diagnostics, "; ")
+}
+
+// ValidateOutput checks code, the generated form of the deobfuscated program p, the way a
+// consumer of the output would see it. code must parse again, with the same number of
+// functions, the same kinds of top-level statements and the same string literals as p, and p
+// must not hold number literals the generator cannot print faithfully, such as NaN, -0 or a
+// rewritten literal that still carries its old source text. It returns a *ValidationError
+// listing every failed check.
+func ValidateOutput(p *ast.Program, code string) error {
+	diags := lossyLiterals(p)
+
+	reparsed, err := parser.ParseFile(code)
+	if err != nil {
+		diags = append(diags, fmt.Sprintf("generated code does not parse: %v", err))
+	} else {
+		diags = append(diags, compareStructure(p, reparsed)...)
+	}
+
+	if len(diags) == 0 {
+		return nil
+	}
+	return &ValidationError{Diagnostics: diags}
+}
+
+// lossyLiterals reports number literals whose printed form does not read back as their value.
+func lossyLiterals(p *ast.Program) []string {
+	var diags []string
+	for _, m := range astmatch.FindAll(p, astmatch.Is[*ast.NumberLiteral]()) {
+		n := m.Node.(*ast.NumberLiteral)
+		where := ""
+		if off := nodeOffset(n); off >= 0 {
+			where = fmt.Sprintf(" at offset %d", off)
+		}
+
+		switch {
+		case n.Raw != nil:
+			if v, ok := parseNumberRaw(*n.Raw); !ok || v != n.Value {
+				diags = append(diags, fmt.Sprintf("number literal%s prints as %s but holds %v", where, *n.Raw, n.Value))
+			}
+		// Negative numbers print as the negation of a literal, which reads back as the same
+		// value. NaN and the infinities print as globals a local binding can shadow, and a -0
+		// literal is nearly always a folding slip, since -0 compares equal to 0.
+		case math.IsNaN(n.Value), math.IsInf(n.Value, 0), n.Value == 0 && math.Signbit(n.Value):
+			diags = append(diags, fmt.Sprintf("number literal %v%s has no literal form", formatJSNumber(n.Value), where))
+		}
+	}
+	return diags
+}
+
+// parseNumberRaw reads the source text of a number literal with the rules of the JS lexer:
+// radix prefixes take any number of digits, a leading 0 followed only by octal digits is a
+// legacy octal literal, and decimals beyond the range of a double are Infinity.
+func parseNumberRaw(raw string) (float64, bool) {
+	raw = strings.ReplaceAll(raw, "_", "")
+	if len(raw) > 1 && raw[0] == '0' && strings.Trim(raw, "01234567") == "" {
+		return jsnum.ParseInt(raw[1:], 8), true
+	}
+	v := jsnum.ToNumber(raw)
+	return v, !math.IsNaN(v)
+}
+
+// formatJSNumber formats v the way JS prints it, except that -0 keeps its sign.
+func formatJSNumber(v float64) string {
+	if v == 0 && math.Signbit(v) {
+		return "-0"
+	}
+	return jsnum.ToString(v)
+}
+
+// compareStructure reports where the re-parsed output differs from the program it was
+// generated from.
+func compareStructure(p, reparsed *ast.Program) []string {
+	var diags []string
+
+	functions := astmatch.AnyOf(astmatch.Is[*ast.FunctionLiteral](), astmatch.Is[*ast.ArrowFunctionLiteral]())
+	if want, got := len(astmatch.FindAll(p, functions)), len(astmatch.FindAll(reparsed, functions)); want != got {
+		diags = append(diags, fmt.Sprintf("output has %d functions, want %d", got, want))
+	}
+
+	if want, got := len(p.Body), len(reparsed.Body); want != got {
+		diags = append(diags, fmt.Sprintf("output has %d top-level statements, want %d", got, want))
+	} else {
+		for i := range p.Body {
+			want, got := reflect.TypeOf(p.Body[i].Stmt), reflect.TypeOf(reparsed.Body[i].Stmt)
+			if want != got {
+				diags = append(diags, fmt.Sprintf("top-level statement %d is a %v, want %v", i, got, want))
+				break
+			}
+		}
+	}
+
+	want, got := stringLiterals(p), stringLiterals(reparsed)
+	for i := 0; i < len(want) && i < len(got); i++ {
+		if want[i] != got[i] {
+			diags = append(diags, fmt.Sprintf("string literal %d reads back as %q, want %q", i, got[i], want[i]))
+			return diags
+		}
+	}
+	if len(want) != len(got) {
+		diags = append(diags, fmt.Sprintf("output has %d string literals, want %d", len(got), len(want)))
+	}
+	return diags
+}
+
+func stringLiterals(p *ast.Program) []string {
+	var values []string
+	for _, m := range astmatch.FindAll(p, astmatch.Is[*ast.StringLiteral]()) {
+		values = append(values, m.Node.(*ast.StringLiteral).Value)
+	}
+	return values
+}